@@ -21,11 +21,22 @@ import { PlayerQueries } from '../gql/player'
 
 const httpLink = new HttpLink({
     uri: `${(location.protocol == 'https:') ? "https" : "http"}://${window.location.hostname}/graphql`,
+    fetch: (uri, options) => {
+        if (existsCookie("session")) {
+            options.headers = Object.assign({}, options.headers, {
+                Authorization: `Bearer ${getCookie("session")}`
+            });
+        }
+        return fetch(uri, options);
+    }
 });
 const wsLink = new WebSocketLink({
     uri: `${(location.protocol == 'https:') ? "wss" : "ws"}://${window.location.hostname}/wsgraphql`,
     options: {
-        reconnect: true
+        reconnect: true,
+        connectionParams: () => ({
+            authToken: getCookie("session")
+        })
     }
 });
 
@@ -49,7 +60,7 @@ const client = new ApolloClient({
 function AppRoot() {
     const { loading, error, data } = useQuery(PlayerQueries.getState, {
         variables: { playerId: getCookie("user-id") },
-        skip: !existsCookie("user-id")
+        skip: !existsCookie("user-id") || !existsCookie("session")
     });
 
     if (loading) return 'Loading...';
@@ -59,7 +70,7 @@ function AppRoot() {
     }
 
     const [userPreferences, setUserPreferences] = useState({
-        showPreferences: !existsCookie("user-id") || (data.player == null)
+        showPreferences: !existsCookie("session") || (data.player == null)
     });
 
     const player = data ? data.player : null
@@ -6,32 +6,44 @@ export const GameSubscriptions = {
         subscription Game($gameId: String!) {
             game(gameId: $gameId) {
                 id
+                host {
+                    id
+                }
                 players {
                     id
                     name
                 }
-                state {
+                status
+                remainingTime
+                seats
+                roles {
                     name
+                    value
                 }
                 playerState {
                     player {
                         id
                         name
                     }
+                    coManagers {
+                        id
+                        name
+                    }
                     role {
                         name
                         value
                     }
-                    outgoing
+                    ready
                 }
             }
         }
     `,
     playerState: gql`
-        subscription PlayerState($gameId: String!, $playerId: String!) {
+        subscription PlayerState($gameId: String!, $playerId: String) {
             playerState(gameId: $gameId, playerId: $playerId) {
                 incoming
                 outgoing
+                ready
                 stock
                 backlog
                 lastsent
@@ -58,8 +70,8 @@ export const GameQueries = {
         }
     `,
     joinGame: gql`
-        mutation JoinGame($gameId: String!, $playerId: String!) {
-            addPlayer(gameId: $gameId, playerId: $playerId)
+        mutation JoinGame($gameId: String!) {
+            addPlayer(gameId: $gameId)
         }
     `,
     leaveGame: gql`
@@ -73,8 +85,8 @@ export const GameQueries = {
         }
     `,
     setRole: gql`
-        mutation ChangePlayerRole($gameId: String!, $playerId: String!, $role: Int!) {
-            changePlayerRole(gameId: $gameId, playerId: $playerId, role: $role)
+        mutation ChangePlayerRole($gameId: String!, $role: Int!) {
+            changePlayerRole(gameId: $gameId, role: $role)
         }
     `,
     submitLastWeek: gql`
@@ -83,8 +95,13 @@ export const GameQueries = {
         }
     `,
     submitOutgoing: gql`
-        mutation SubmitOutgoing($gameId: String!, $playerId: String!, $outgoing: Int!) {
-            submitOutgoing(gameId: $gameId, playerId: $playerId, outgoing: $outgoing)
+        mutation SubmitOutgoing($gameId: String!, $outgoing: Int!) {
+            submitOutgoing(gameId: $gameId, outgoing: $outgoing)
+        }
+    `,
+    lockOrder: gql`
+        mutation LockOrder($gameId: String!) {
+            lockOrder(gameId: $gameId)
         }
     `,
 };
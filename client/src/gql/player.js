@@ -11,8 +11,8 @@ export const PlayerQueries = {
         }
     `,
     createPlayer: gql`
-        mutation CreatePlayer($playerId: String!, $playerName: String!) {
-            createPlayer(playerId: $playerId, playerName: $playerName)
+        mutation CreatePlayer($playerName: String!) {
+            createPlayer(playerName: $playerName)
         }
     `,
 };
@@ -1,4 +1,4 @@
-import { useEffect } from 'preact/hooks';
+import { useState, useEffect } from 'preact/hooks';
 
 import { useQuery, useMutation, useSubscription } from '@apollo/react-hooks';
 
@@ -6,6 +6,10 @@ import Lobby from "./lobby"
 import Play from "./play"
 
 import { GameQueries, GameSubscriptions } from '../../gql/game'
+import { errorCodes, errorMessage } from '../../utils/errors'
+
+// Joining fails with these when revisiting a game, which is expected.
+const expectedJoinErrors = ["ALREADY_IN_GAME", "NOT_IN_LOBBY"];
 
 function Game({ id }) {
     const { loading, error, data } = useSubscription(GameSubscriptions.gameState, {
@@ -17,6 +21,7 @@ function Game({ id }) {
             gameId: id
         }
     });
+    const [joinError, setJoinError] = useState(null);
 
     if (loading) return 'Loading...';
     if (error) {
@@ -25,18 +30,39 @@ function Game({ id }) {
     }
 
     useEffect(() => {
-        joinGame({ variables: { playerId: this.props.user.id }});
+        joinGame().then(() => setJoinError(null)).catch(error => {
+            const codes = errorCodes(error);
+            if (codes.length > 0 && codes.every(code => expectedJoinErrors.includes(code))) {
+                setJoinError(null);
+                return;
+            }
+            setJoinError(errorMessage(error));
+        });
     }, [this.props.user.id]);
 
-    if (data.game.state.name == "lobby") {
+    const joinFailure = joinError && (
+        <p>Could not join the game: {joinError}</p>
+    );
+
+    if (!data.game) {
+        // Games are created by the first player to join them.
+        return joinFailure || 'Joining...';
+    }
+    if (data.game.status == "LOBBY") {
         return (
-            <Lobby user={this.props.user} game={data.game} />
+            <div>
+                {joinFailure}
+                <Lobby user={this.props.user} game={data.game} />
+            </div>
         );
-    } else if (data.game.state.name == "playing") {
+    } else if (data.game.status == "PLAYING" || data.game.status == "PAUSED") {
         return (
-            <Play user={this.props.user} game={data.game} />
+            <div>
+                {joinFailure}
+                <Play user={this.props.user} game={data.game} paused={data.game.status == "PAUSED"} />
+            </div>
         );
-    } else if (data.game.state.name == "finished") {
+    } else if (data.game.status == "FINISHED") {
         <div>
             <h1>'{this.props.id}'</h1>
             TODO: Finished
@@ -45,7 +71,7 @@ function Game({ id }) {
     return (
         <div>
             <h1>'{this.props.id}'</h1>
-            ERROR: unknown state '{data.game.state.name}''
+            ERROR: unknown state '{data.game.status}''
         </div>
     )
 }
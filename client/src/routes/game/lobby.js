@@ -1,72 +1,107 @@
-import { useQuery, useMutation } from '@apollo/react-hooks';
+import { useState } from 'preact/hooks';
 
-import { GameQueries } from '../../gql/game'
+import { useMutation } from '@apollo/react-hooks';
 
-function Lobby() {
-    const { loading, error, data } = useQuery(GameQueries.getRoles);
+import { GameQueries } from '../../gql/game'
+import { errorMessage } from '../../utils/errors'
 
-    if (loading) return 'Loading...';
-    if (error) {
-        console.log(error);
-        return "Error!";
-    }
+// Everyone seated at a stage: the holder first, then any co-managers.
+function seatHolders(state) {
+    return [state.player].concat(state.coManagers || []);
+}
 
+function Lobby() {
     const [leaveGame] = useMutation(GameQueries.leaveGame, {
-        variables: { 
+        variables: {
             gameId: this.props.game.id
         },
     });
     const [startGame] = useMutation(GameQueries.startGame, {
-        variables: { 
+        variables: {
             gameId: this.props.game.id
         },
     });
     const [changeRole] = useMutation(GameQueries.setRole, {
-        variables: { 
+        variables: {
             gameId: this.props.game.id
         },
     });
+    const [roleError, setRoleError] = useState(null);
+
+    const game = this.props.game;
+    const userId = this.props.user.id;
+    const isHost = game.host != null && game.host.id == userId;
+
+    const seated = role => game.playerState
+        .filter(state => state.role.value == role.value)
+        .reduce((players, state) => players.concat(seatHolders(state)), []);
+    const openSeats = role => Math.max(game.seats - seated(role).length, 0);
+    const ownState = game.playerState.find(state =>
+        seatHolders(state).some(player => player.id == userId));
+    const ownRole = ownState ? ownState.role.value : 0;
+
+    const player = player => (
+        <li>
+            <span>{player.name || player.id}</span>
+            &nbsp;
+            {(isHost || player.id == userId) && (
+                <span>
+                    [<a href="#" onClick={e => {
+                        e.preventDefault();
+                        leaveGame({ variables: { playerId: player.id }});
+                    }}>{player.id == userId ? (
+                        'Leave'
+                    ) : (
+                        'Kick'
+                    )}</a>]
+                </span>
+            )}
+        </li>
+    );
 
     return (
         <div>
-        <h1>'{this.props.game.id}'</h1>
-            <ul>
-                {this.props.game.playerState.map(state => (
-                    <li>
-                        <span>{state.player.name}</span>
-                        &nbsp;
-                        <span>
-                            {state.player.id == this.props.user.id ? (
-                                <select value={state.role.value} onChange={e => {
-                                    e.preventDefault();
-                                    changeRole({ variables: { playerId: state.player.id, role: e.target.value }});
-                                }}>{data.gameRoles.map(role => (
-                                    <option value={role.value}>{role.name}</option>
-                                ))}</select>
-                            ) : (
-                                <span>{state.role.name}</span>
-                            )}
-                        </span>
-                        &nbsp;
-                        <span>
-                            [<a href="#" onClick={e => {
-                                e.preventDefault();
-                                leaveGame({ variables: { playerId: state.player.id }});
-                            }}>{state.player.id == this.props.user.id ? (
-                                'Leave'
-                            ) : (
-                                'Kick'
-                            )}</a>]
-                        </span>
-                    </li>
-                ))}
-            </ul>
-            <a href="#" onClick={e => {
-                e.preventDefault();
-                startGame();
-            }}>Start</a>
+        <h1>'{game.id}'</h1>
+            <p>
+                Your role:&nbsp;
+                <select value={ownRole} onChange={e => {
+                    e.preventDefault();
+                    changeRole({ variables: { role: e.target.value }})
+                        .then(() => setRoleError(null))
+                        .catch(error => setRoleError(errorMessage(error)));
+                }}>{game.roles.map(role => (
+                    <option value={role.value}
+                        disabled={role.value != 0 && role.value != ownRole && openSeats(role) == 0}>
+                        {role.name}
+                    </option>
+                ))}</select>
+            </p>
+            {roleError && (
+                <p>Could not change role: {roleError}</p>
+            )}
+            {game.roles.map(role => (
+                <div>
+                    <h2>
+                        {role.name}
+                        {role.value != 0 && (
+                            <span>
+                                &nbsp;({openSeats(role) == 0 ? 'full' : `${openSeats(role)} of ${game.seats} seats open`})
+                            </span>
+                        )}
+                    </h2>
+                    <ul>
+                        {seated(role).map(player)}
+                    </ul>
+                </div>
+            ))}
+            {isHost && (
+                <a href="#" onClick={e => {
+                    e.preventDefault();
+                    startGame();
+                }}>Start</a>
+            )}
         </div>
     );
 }
 
-export default Lobby;
\ No newline at end of file
+export default Lobby;
@@ -1,9 +1,25 @@
-import { useState } from 'preact/hooks';
+import { useState, useEffect } from 'preact/hooks';
 
 import { useQuery, useMutation, useSubscription } from '@apollo/react-hooks';
 
 import { GameQueries, GameSubscriptions } from '../../gql/game'
 
+function Countdown(props) {
+    const [deadline, setDeadline] = useState(Date.now() + props.remaining * 1000);
+    const [now, setNow] = useState(Date.now());
+
+    useEffect(() => {
+        setDeadline(Date.now() + props.remaining * 1000);
+    }, [props.remaining]);
+    useEffect(() => {
+        const timer = setInterval(() => setNow(Date.now()), 1000);
+        return () => clearInterval(timer);
+    }, []);
+
+    const seconds = Math.max(0, Math.ceil((deadline - now) / 1000));
+    return <div class="countdown">{seconds}s left</div>;
+}
+
 function Play() {
     const { loading, error, data } = useSubscription(GameSubscriptions.playerState, {
         variables: {
@@ -25,20 +41,28 @@ function Play() {
     });
     const [setOutgoing] = useMutation(GameQueries.submitOutgoing, {
         variables: {
-            gameId: this.props.game.id,
-            playerId: this.props.user.id
+            gameId: this.props.game.id
+        },
+    });
+    const [lockOrder] = useMutation(GameQueries.lockOrder, {
+        variables: {
+            gameId: this.props.game.id
         },
     });
+    const locked = data.playerState.ready;
 
     return (
         <div>
             <h1>'{this.props.game.id}'</h1>
+            {this.props.paused && <div class="paused">Paused by the host</div>}
+            {this.props.game.remainingTime != null &&
+                <Countdown remaining={this.props.game.remainingTime} />}
 
             <div class="player-state">
                 {this.props.game.playerState.sort(function(a, b) {
                     return a.role.value - b.role.value;
                 }).map(state => (
-                    <div class={"block " + (state.outgoing == -1 ? "waiting" : "done")}>
+                    <div class={"block " + (state.ready ? "done" : "waiting")}>
                         {state.player.name}
                         <div class="role">{state.role.name}</div>
                     </div>
@@ -54,20 +78,29 @@ function Play() {
                     <span class="title">Outgoing</span>
                     <form class="value" onSubmit={e => {
                         e.preventDefault();
+                        if (this.props.paused || locked) return;
                         setOutgoing({ variables: { outgoing: state.value } });
                         setState({ value: '', valid: false });
                     }}>
-                        <input type="text" value={state.value} class={
+                        <input type="text" value={state.value} disabled={this.props.paused || locked} class={
                             state.valid ? "input valid" : "input invalid"
                         } onInput={e => {
                             const { value } = e.target;
 
                             const intValue = Number(value)
-                            var isValid = (value.length > 0) && (intValue != NaN && intValue >= 0 && intValue < 2147483647);
+                            var isValid = (value.length > 0) && (intValue != NaN && intValue >= 0 && intValue <= 10000);
 
                             setState({ value: value, valid: isValid });
                         }} />
                     </form>
+                    {data.playerState.outgoing != -1 && (
+                        <span class="pending">
+                            { data.playerState.outgoing }
+                            <button disabled={this.props.paused || locked} onClick={() => lockOrder()}>
+                                { locked ? "Locked in" : "Lock in" }
+                            </button>
+                        </span>
+                    )}
                 </div>
                 <div class="block backlog">
                     <span class="title">Backlog</span>
@@ -2,8 +2,7 @@ import { useState } from 'preact/hooks';
 
 import { useQuery, useMutation } from '@apollo/react-hooks';
 
-import { existsCookie, setCookie, getCookie } from '../../utils/cookie';
-import { generateUUID } from '../../utils/uuid';
+import { setCookie } from '../../utils/cookie';
 
 import { PlayerQueries } from '../../gql/player'
 
@@ -18,25 +17,22 @@ function Preferences() {
             <form onSubmit={e => {
                 e.preventDefault();
 
-                const userId = existsCookie("user-id") ? getCookie("user-id") : generateUUID();
                 const userName = state.name;
 
-                setCookie("user-id", userId);
-
                 createPlayer({
                     variables: {
-                        playerId: userId,
                         playerName: userName
                     },
-                    refetchQueries: [{
-                        query: PlayerQueries.getState,
-                        variables: { playerId: userId }
-                    }],
-                    awaitRefetchQueries: true,
-                });
+                }).then(({ data }) => {
+                    const token = data.createPlayer;
+                    if (!token) return;
+
+                    const userId = token.substring(0, token.lastIndexOf("."));
+                    setCookie("session", token);
+                    setCookie("user-id", userId);
 
-                this.props.setUserPreferences({
-                    showPreferences: false
+                    // Reconnect so the websocket is authenticated as the new player.
+                    window.location.reload();
                 });
             }}>
                 <input type="text" value={state.name} onInput={e => {
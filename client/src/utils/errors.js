@@ -0,0 +1,15 @@
+// errorCodes lists the codes the server put in the extensions of the
+// GraphQL errors of a failed request.
+export function errorCodes(error) {
+    return (error.graphQLErrors || [])
+        .map(graphQLError => graphQLError.extensions && graphQLError.extensions.code)
+        .filter(code => code);
+}
+
+// errorMessage describes a failed request to the player.
+export function errorMessage(error) {
+    if (error.graphQLErrors && error.graphQLErrors.length > 0) {
+        return error.graphQLErrors.map(graphQLError => graphQLError.message).join(', ');
+    }
+    return error.message;
+}
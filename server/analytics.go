@@ -0,0 +1,158 @@
+package main
+
+// Analytics are the debrief statistics of a finished game. The benchmark
+// replays the game with the same demand and settings, but with a base stock
+// bot in every role.
+type Analytics struct {
+	Weeks         int             `json:"weeks"`
+	TotalCost     Money           `json:"totalCost"`
+	BenchmarkCost Money           `json:"benchmarkCost"`
+	Roles         []RoleAnalytics `json:"roles"`
+}
+
+// RoleAnalytics compares the variance of a stage's orders with that of the
+// customer demand it ultimately serves.
+type RoleAnalytics struct {
+	Role            int     `json:"role"`
+	Stage           string  `json:"stage"`
+	DemandVariance  float64 `json:"demandVariance"`
+	OrderVariance   float64 `json:"orderVariance"`
+	PeakBacklog     int     `json:"peakBacklog"`
+	PeakBacklogWeek int     `json:"peakBacklogWeek"`
+	Cost            Money   `json:"cost"`
+	BenchmarkCost   Money   `json:"benchmarkCost"`
+}
+
+// Amplification is the bullwhip ratio, or false if demand never varied.
+func (role RoleAnalytics) Amplification() (float64, bool) {
+	if role.DemandVariance == 0 {
+		return 0, false
+	}
+	return role.OrderVariance / role.DemandVariance, true
+}
+
+func variance(values []int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	mean := 0.0
+	for _, value := range values {
+		mean += float64(value)
+	}
+	mean /= float64(len(values))
+	sum := 0.0
+	for _, value := range values {
+		sum += (float64(value) - mean) * (float64(value) - mean)
+	}
+	return sum / float64(len(values))
+}
+
+// Serves reports whether goods from role eventually reach customer.
+func (game *Game) Serves(role int, customer int) bool {
+	for customer != NONE {
+		if customer == role {
+			return true
+		}
+		customer = game.Stage(customer).Supplier
+	}
+	return false
+}
+
+// finish ends the game and works out its debrief statistics. They are kept
+// on the game, since the benchmark replays the whole game. The replay itself
+// finishes without any.
+func (game *Game) finish() {
+	game.State = FINISHED
+	if !game.benchmark {
+		game.Debrief = game.Analytics()
+	}
+}
+
+// Analytics computes the debrief statistics, or returns nil until the game
+// is finished. Reads should use Debrief instead.
+func (game *Game) Analytics() *Analytics {
+	if game.State != FINISHED {
+		return nil
+	}
+	stages, complete := game.StagePlayers()
+	if !complete {
+		return nil
+	}
+
+	analytics := &Analytics{Roles: []RoleAnalytics{}}
+	for role := 1; role < len(stages); role++ {
+		if weeks := len(stages[role].History); weeks > analytics.Weeks {
+			analytics.Weeks = weeks
+		}
+	}
+	benchmark := game.Benchmark(analytics.Weeks)
+
+	for role := 1; role < len(stages); role++ {
+		history := stages[role].History
+
+		demand := make([]int, len(history))
+		for retailer := 1; retailer < len(stages); retailer++ {
+			if !game.SellsToMarket(retailer) || !game.Serves(role, retailer) {
+				continue
+			}
+			for week, record := range stages[retailer].History {
+				if week < len(demand) {
+					demand[week] += record.Incoming
+				}
+			}
+		}
+
+		roleAnalytics := RoleAnalytics{
+			Role:           role,
+			Stage:          game.Stage(role).Name,
+			DemandVariance: variance(demand),
+			Cost:           stages[role].Costs,
+		}
+		orders := []int{}
+		for _, record := range history {
+			orders = append(orders, record.Ordered)
+			if record.BacklogAfter > roleAnalytics.PeakBacklog {
+				roleAnalytics.PeakBacklog = record.BacklogAfter
+				roleAnalytics.PeakBacklogWeek = record.Week
+			}
+		}
+		roleAnalytics.OrderVariance = variance(orders)
+		if benchmark != nil {
+			roleAnalytics.BenchmarkCost = benchmark[role].Costs
+		}
+
+		analytics.TotalCost += roleAnalytics.Cost
+		analytics.BenchmarkCost += roleAnalytics.BenchmarkCost
+		analytics.Roles = append(analytics.Roles, roleAnalytics)
+	}
+	return analytics
+}
+
+// Benchmark plays weeks of a copy of the game with base stock bots in every
+// role, and returns the copy's stages indexed by role.
+func (game *Game) Benchmark(weeks int) []*PlayerState {
+	if weeks == 0 {
+		return nil
+	}
+	replay := &Game{
+		ID:          game.ID,
+		State:       LOBBY,
+		PlayerState: []*PlayerState{},
+		Stages:      game.Stages,
+		LastWeek:    weeks,
+		Demand:      game.Demand,
+		Seed:        game.Seed,
+		Costs:       game.Costs,
+		Fulfilment:  game.Fulfilment,
+		Initial:     game.Initial,
+		benchmark:   true,
+	}
+	for role := 1; role <= len(game.Stages); role++ {
+		replay.AddBot(role, STRATEGY_BASE_STOCK)
+	}
+	if replay.Start() != nil {
+		return nil
+	}
+	stages, _ := replay.StagePlayers()
+	return stages
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+// botGame plays a whole game of weeks weeks with bots in every role.
+func botGame(t *testing.T, id string, weeks int) *Game {
+	game := newTestGame(t, id, []string{id + "-host"})
+	err := game.Apply(func() error {
+		if err := game.RemovePlayer(id + "-host"); err != nil {
+			return err
+		}
+		for role := 1; role <= len(game.Stages); role++ {
+			if err := game.AddBot(role, STRATEGY_BASE_STOCK); err != nil {
+				return err
+			}
+		}
+		game.LastWeek = weeks
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+func TestAnalyticsAreKeptWhenTheGameFinishes(t *testing.T) {
+	schema := testSchema(t)
+	game := botGame(t, "debrief", 10)
+	if game.State != FINISHED || game.Debrief == nil {
+		t.Fatalf("the game is in state %d with debrief %v", game.State, game.Debrief)
+	}
+	if game.Debrief.Weeks != 10 || len(game.Debrief.Roles) != len(game.Stages) {
+		t.Errorf("got debrief of %d weeks and %d roles", game.Debrief.Weeks, len(game.Debrief.Roles))
+	}
+	if game.Debrief.BenchmarkCost != game.Debrief.TotalCost {
+		t.Errorf("base stock bots cost %d, but their replay cost %d", game.Debrief.TotalCost, game.Debrief.BenchmarkCost)
+	}
+
+	result := execute(schema, "debrief-host", `{ game(gameId: "debrief") { analytics { weeks } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+
+	if err := game.Apply(func() error { return game.Rewind(5) }); err != nil {
+		t.Fatal(err)
+	}
+	if game.Debrief != nil {
+		t.Error("rewinding kept the debrief of the finished game")
+	}
+}
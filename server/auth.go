@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Players are identified by a session token of the form "<playerId>.<mac>",
+// where mac is an HMAC-SHA256 of the player id under the server's secret.
+// The token is sent as a bearer token, or in the authToken field of a
+// websocket connection_init payload. Browsers attach cookies to cross-site
+// requests, so the "session" cookie the client keeps its token in is only
+// trusted for downloads, which change nothing and cannot be read cross-site.
+
+const SessionCookie = "session"
+
+var sessionSecret []byte
+
+type contextKey int
+
+const playerContextKey contextKey = iota
+
+// InitSessionSecret uses $BEERGAME_SECRET if it is set, otherwise the secret
+// kept in the store so that tokens stay valid across restarts.
+func InitSessionSecret(store Store) error {
+	if secret := os.Getenv("BEERGAME_SECRET"); secret != "" {
+		sessionSecret = []byte(secret)
+		return nil
+	}
+	secret, err := store.LoadSecret()
+	if err != nil {
+		return err
+	}
+	sessionSecret = secret
+	return nil
+}
+
+func NewSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func sign(playerID string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(playerID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func SessionToken(playerID string) string {
+	return playerID + "." + sign(playerID)
+}
+
+// VerifySessionToken returns the player id the token was issued for.
+func VerifySessionToken(token string) (string, bool) {
+	index := strings.LastIndex(token, ".")
+	if index <= 0 || len(sessionSecret) == 0 {
+		return "", false
+	}
+	playerID := token[:index]
+	if IsBotID(playerID) {
+		return "", false
+	}
+	if !hmac.Equal([]byte(token[index+1:]), []byte(sign(playerID))) {
+		return "", false
+	}
+	return playerID, true
+}
+
+func WithPlayer(ctx context.Context, playerID string) context.Context {
+	return context.WithValue(ctx, playerContextKey, playerID)
+}
+
+// ActingPlayer returns the authenticated player for a request, or "".
+func ActingPlayer(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	playerID, _ := ctx.Value(playerContextKey).(string)
+	return playerID
+}
+
+func requestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// RequestPlayer returns the player authenticated by the request's token.
+func RequestPlayer(r *http.Request) string {
+	playerID, _ := VerifySessionToken(requestToken(r))
+	return playerID
+}
+
+// DownloadPlayer is RequestPlayer for GET requests made by following a link,
+// which also accepts the session cookie.
+func DownloadPlayer(r *http.Request) string {
+	if playerID := RequestPlayer(r); playerID != "" || r.Method != http.MethodGet {
+		return playerID
+	}
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return ""
+	}
+	playerID, _ := VerifySessionToken(cookie.Value)
+	return playerID
+}
+
+// Authenticate adds the requesting player to the request context. Requests
+// with a missing or invalid token are served anonymously.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if playerID := RequestPlayer(r); playerID != "" {
+			r = r.WithContext(WithPlayer(r.Context(), playerID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func NewPlayerID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Bots are server-side players. They hold a role like any other player and
+// place their order as soon as a week opens.
+
+const (
+	STRATEGY_PASS_THROUGH = iota
+	STRATEGY_BASE_STOCK
+	STRATEGY_STERMAN
+	STRATEGY_RANDOM
+)
+
+var StrategyMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "pass through",
+		Value: STRATEGY_PASS_THROUGH,
+	},
+	NameValueMapping{
+		Name:  "base stock",
+		Value: STRATEGY_BASE_STOCK,
+	},
+	NameValueMapping{
+		Name:  "sterman",
+		Value: STRATEGY_STERMAN,
+	},
+	NameValueMapping{
+		Name:  "random",
+		Value: STRATEGY_RANDOM,
+	},
+}
+
+// Bot is the state a bot keeps between weeks. Forecast is its exponentially
+// smoothed estimate of the orders it receives each week.
+type Bot struct {
+	Strategy int     `json:"strategy"`
+	Forecast float64 `json:"forecast"`
+}
+
+// FORECAST_SMOOTHING is the weight of the latest week in a bot's forecast.
+const FORECAST_SMOOTHING = 0.36
+
+type Strategy interface {
+	Order(game *Game, p *PlayerState, rng *rand.Rand) int
+}
+
+func NewStrategy(strategy int) Strategy {
+	switch strategy {
+	case STRATEGY_BASE_STOCK:
+		return BaseStockStrategy{}
+	case STRATEGY_STERMAN:
+		return StermanStrategy{Alpha: 0.26, Beta: 0.34, Target: 17}
+	case STRATEGY_RANDOM:
+		return RandomStrategy{}
+	}
+	return PassThroughStrategy{}
+}
+
+// PassThroughStrategy orders whatever its customers ordered.
+type PassThroughStrategy struct{}
+
+func (PassThroughStrategy) Order(game *Game, p *PlayerState, rng *rand.Rand) int {
+	if len(p.OutgoingPrev) == 0 {
+		return roundOrder(p.Bot.Forecast)
+	}
+	return p.Incoming
+}
+
+// BaseStockStrategy orders up to the forecast demand over its lead time and
+// the week of review.
+type BaseStockStrategy struct{}
+
+func (BaseStockStrategy) Order(game *Game, p *PlayerState, rng *rand.Rand) int {
+	stage := game.Stage(p.Role)
+	leadTime := stage.ShippingDelay + stage.OrderDelay
+	target := int(math.Ceil(p.Bot.Forecast * float64(leadTime+1)))
+	return roundOrder(float64(target - (p.Stock - p.Backlog + p.Outstanding)))
+}
+
+// StermanStrategy is the anchoring and adjustment heuristic fitted to human
+// players by Sterman (1989): it replaces expected demand and corrects a
+// fraction Alpha of the gap between Target and its stock, counting only a
+// fraction Beta of the supply line.
+type StermanStrategy struct {
+	Alpha  float64
+	Beta   float64
+	Target float64
+}
+
+func (strategy StermanStrategy) Order(game *Game, p *PlayerState, rng *rand.Rand) int {
+	gap := strategy.Target - float64(p.Stock-p.Backlog) - strategy.Beta*float64(p.Outstanding)
+	return roundOrder(p.Bot.Forecast + strategy.Alpha*gap)
+}
+
+// RandomStrategy orders anything from nothing to twice the forecast.
+type RandomStrategy struct{}
+
+func (RandomStrategy) Order(game *Game, p *PlayerState, rng *rand.Rand) int {
+	return rng.Intn(2*roundOrder(p.Bot.Forecast) + 1)
+}
+
+func roundOrder(order float64) int {
+	if order < 0 {
+		return 0
+	}
+	return int(math.Round(order))
+}
+
+// DisplayPlayer is the player holding a role, with a made-up player for bots.
+func DisplayPlayer(playerState *PlayerState) *Player {
+	if playerState.Bot != nil {
+		name := StrategyMappings[playerState.Bot.Strategy].Name + " bot"
+		return &Player{ID: playerState.PlayerID, Name: name}
+	}
+	if player := FindPlayer(playerState.PlayerID); player != nil {
+		return player
+	}
+	return &Player{ID: playerState.PlayerID}
+}
+
+const botPrefix = "bot-"
+
+func BotID(role int) string {
+	return fmt.Sprintf("%s%d", botPrefix, role)
+}
+
+// IsBotID reports whether id is reserved for bots. No player can have such an
+// id, so nobody can act as a bot.
+func IsBotID(id string) bool {
+	return strings.HasPrefix(id, botPrefix)
+}
+
+func (game *Game) BotRand(role int) *rand.Rand {
+	return rand.New(rand.NewSource(game.Seed*7919 + int64(game.Week*MAX_STAGES+role)))
+}
+
+// AddBot puts a bot with the given strategy in an empty role.
+func (game *Game) AddBot(role int, strategy int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !game.ValidRole(role) {
+		return errInvalidRole(role)
+	}
+	if strategy < 0 || strategy >= len(StrategyMappings) {
+		return errInvalidArgument("there is no bot strategy %d", strategy)
+	}
+	if game.Holder(role) != nil {
+		return NewGameError(ERROR_ROLE_TAKEN, "the %s is already played", game.Stage(role).Name)
+	}
+	if err := game.AddPlayer(BotID(role)); err != nil {
+		return err
+	}
+	playerState := game.FindPlayerState(BotID(role))
+	playerState.Role = role
+	playerState.Bot = &Bot{Strategy: strategy}
+	return nil
+}
+
+// PlayBots updates each bot's forecast and places its order for the week.
+func (game *Game) PlayBots() {
+	for _, playerState := range game.PlayerState {
+		bot := playerState.Bot
+		if bot == nil || playerState.Ready || !game.ValidRole(playerState.Role) {
+			continue
+		}
+		if len(playerState.OutgoingPrev) == 0 {
+			bot.Forecast = float64(game.Initial.Conditions(playerState.Role).Shipment)
+		} else {
+			bot.Forecast = FORECAST_SMOOTHING*float64(playerState.Incoming) + (1-FORECAST_SMOOTHING)*bot.Forecast
+		}
+		playerState.Outgoing = NewStrategy(bot.Strategy).Order(game, playerState, game.BotRand(playerState.Role))
+		playerState.Ready = true
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	MIN_STAGES = 2
+	MAX_STAGES = 8
+
+	DEFAULT_SHIPPING_DELAY = 2
+	DEFAULT_ORDER_DELAY    = 0
+	MAX_DELAY              = 10
+)
+
+// Stage is one echelon of a game's supply chain. A player's role is the
+// 1-based index of their stage in Game.Stages. Supplier is the role that
+// ships to this stage, or NONE if the stage produces its own goods. Stages
+// that nobody orders from sell to the end customer.
+//
+// ShippingDelay is the number of weeks between the supplier shipping and the
+// goods arriving in stock, and OrderDelay the number of weeks before an
+// order reaches the supplier. For production stages they are the production
+// lead time and the time to process a production order.
+type Stage struct {
+	Name          string `json:"name"`
+	Supplier      int    `json:"supplier"`
+	ShippingDelay int    `json:"shippingDelay"`
+	OrderDelay    int    `json:"orderDelay"`
+}
+
+const (
+	TOPOLOGY_LINEAR = iota
+	TOPOLOGY_DIVERGENT
+)
+
+var TopologyMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "linear",
+		Value: TOPOLOGY_LINEAR,
+	},
+	NameValueMapping{
+		Name:  "divergent",
+		Value: TOPOLOGY_DIVERGENT,
+	},
+}
+
+var intermediateStageNames = []string{"wholesaler", "distributer", "warehouse", "importer", "exporter", "supplier"}
+
+// LinearStages builds a single chain from a retailer to a manufacturer. With
+// four stages it is the classic beer game.
+func LinearStages(length int) []Stage {
+	stages := []Stage{}
+	for role := 1; role <= length; role++ {
+		name := "manufacturer"
+		if role == 1 {
+			name = "retailer"
+		} else if role < length {
+			name = intermediateStageNames[role-2]
+		}
+		supplier := role + 1
+		if role == length {
+			supplier = NONE
+		}
+		stages = append(stages, Stage{
+			Name:          name,
+			Supplier:      supplier,
+			ShippingDelay: DEFAULT_SHIPPING_DELAY,
+			OrderDelay:    DEFAULT_ORDER_DELAY,
+		})
+	}
+	return stages
+}
+
+// DivergentStages has one distributer feeding two wholesalers, each with
+// its own retailer.
+func DivergentStages() []Stage {
+	stages := []Stage{
+		Stage{Name: "retailer a", Supplier: 3},
+		Stage{Name: "retailer b", Supplier: 4},
+		Stage{Name: "wholesaler a", Supplier: 5},
+		Stage{Name: "wholesaler b", Supplier: 5},
+		Stage{Name: "distributer", Supplier: 6},
+		Stage{Name: "manufacturer", Supplier: NONE},
+	}
+	for index := range stages {
+		stages[index].ShippingDelay = DEFAULT_SHIPPING_DELAY
+		stages[index].OrderDelay = DEFAULT_ORDER_DELAY
+	}
+	return stages
+}
+
+// ValidStages checks that stages form a tree: every supplier comes later in
+// the list than its customers, so orders always flow towards production.
+func ValidStages(stages []Stage) bool {
+	if len(stages) < MIN_STAGES || len(stages) > MAX_STAGES {
+		return false
+	}
+	names := map[string]bool{}
+	for index, stage := range stages {
+		role := index + 1
+		if stage.Name == "" || names[stage.Name] {
+			return false
+		}
+		names[stage.Name] = true
+		if stage.Supplier != NONE && (stage.Supplier <= role || stage.Supplier > len(stages)) {
+			return false
+		}
+		if !ValidDelays(stage.ShippingDelay, stage.OrderDelay) {
+			return false
+		}
+	}
+	return true
+}
+
+func ValidDelays(shippingDelay int, orderDelay int) bool {
+	return shippingDelay >= 1 && shippingDelay <= MAX_DELAY && orderDelay >= 0 && orderDelay <= MAX_DELAY
+}
+
+// SetDelays changes the delays into role, or into every stage for NONE.
+func (game *Game) SetDelays(role int, shippingDelay int, orderDelay int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !ValidDelays(shippingDelay, orderDelay) {
+		return errInvalidArgument("shipping delays must be 1 to %d weeks and order delays 0 to %d", MAX_DELAY, MAX_DELAY)
+	}
+	if role != NONE && !game.ValidRole(role) {
+		return errInvalidRole(role)
+	}
+	for index := range game.Stages {
+		if role == NONE || role == index+1 {
+			game.Stages[index].ShippingDelay = shippingDelay
+			game.Stages[index].OrderDelay = orderDelay
+		}
+	}
+	return nil
+}
+
+// SetStages replaces the supply chain, clearing roles that no longer exist.
+func (game *Game) SetStages(stages []Stage) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !ValidStages(stages) {
+		return errInvalidArgument("the stages do not form a valid supply chain")
+	}
+	game.Stages = stages
+	for role := range game.Costs.Roles {
+		if !game.ValidRole(role) {
+			delete(game.Costs.Roles, role)
+		}
+	}
+	for role := range game.Initial.Roles {
+		if !game.ValidRole(role) {
+			delete(game.Initial.Roles, role)
+		}
+	}
+	for _, playerState := range game.PlayerState {
+		if playerState.Role > len(stages) {
+			for len(playerState.CoManagers) > 0 {
+				game.unseat(playerState.CoManagers[0])
+			}
+			playerState.Role = NONE
+		}
+	}
+	return nil
+}
+
+func (game *Game) ValidRole(role int) bool {
+	return role > NONE && role <= len(game.Stages)
+}
+
+func (game *Game) Stage(role int) Stage {
+	return game.Stages[role-1]
+}
+
+// Customers returns the roles supplied by role, in ascending order.
+func (game *Game) Customers(role int) []int {
+	customers := []int{}
+	for index, stage := range game.Stages {
+		if stage.Supplier == role {
+			customers = append(customers, index+1)
+		}
+	}
+	return customers
+}
+
+func (game *Game) SellsToMarket(role int) bool {
+	return len(game.Customers(role)) == 0
+}
+
+// Roles lists the roles players can take in this game, including none.
+func (game *Game) Roles() []NameValueMapping {
+	roles := []NameValueMapping{GameRoleMappings[NONE]}
+	for index, stage := range game.Stages {
+		roles = append(roles, NameValueMapping{Name: stage.Name, Value: index + 1})
+	}
+	return roles
+}
+
+func (game *Game) RoleMapping(role int) NameValueMapping {
+	if !game.ValidRole(role) {
+		return GameRoleMappings[NONE]
+	}
+	return NameValueMapping{Name: game.Stage(role).Name, Value: role}
+}
+
+// StagePlayers returns the player state for each role, indexed by role. It
+// reports false unless every stage has exactly one player and every player
+// has a stage.
+func (game *Game) StagePlayers() ([]*PlayerState, bool) {
+	stages := make([]*PlayerState, len(game.Stages)+1)
+	for _, playerState := range game.PlayerState {
+		if !game.ValidRole(playerState.Role) || stages[playerState.Role] != nil {
+			return nil, false
+		}
+		stages[playerState.Role] = playerState
+	}
+	for role := 1; role < len(stages); role++ {
+		if stages[role] == nil {
+			return nil, false
+		}
+	}
+	return stages, true
+}
+
+// Pipeline is a delay line of goods or orders, soonest first.
+type Pipeline []int
+
+// Next returns what will leave the pipeline on the next Advance.
+func (pipeline Pipeline) Next() int {
+	if len(pipeline) == 0 {
+		return 0
+	}
+	return pipeline[0]
+}
+
+// Advance adds value at the back and removes and returns the front. An
+// empty pipeline has no delay and returns value itself.
+func (pipeline *Pipeline) Advance(value int) int {
+	queue := append(*pipeline, value)
+	*pipeline = queue[1:]
+	return queue[0]
+}
+
+// Allocate splits a shipment between customers in proportion to what each
+// is owed. Units left over by rounding go to the customers owed the most.
+func Allocate(amount int, owed map[int]int) map[int]int {
+	total := 0
+	customers := []int{}
+	for customer, value := range owed {
+		if value > 0 {
+			total += value
+			customers = append(customers, customer)
+		}
+	}
+	sort.Ints(customers)
+
+	shipments := map[int]int{}
+	if total == 0 {
+		return shipments
+	}
+	if amount > total {
+		amount = total
+	}
+
+	remaining := amount
+	for _, customer := range customers {
+		share := amount * owed[customer] / total
+		shipments[customer] = share
+		remaining -= share
+	}
+	sort.SliceStable(customers, func(i, j int) bool {
+		return owed[customers[i]]-shipments[customers[i]] > owed[customers[j]]-shipments[customers[j]]
+	})
+	for _, customer := range customers {
+		if remaining == 0 {
+			break
+		}
+		if shipments[customer] < owed[customer] {
+			shipments[customer]++
+			remaining--
+		}
+	}
+	return shipments
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// arrival returns the first week in which role received anything, and what
+// it received.
+func arrival(game *Game, role int) (int, int) {
+	stages, _ := game.StagePlayers()
+	for _, record := range stages[role].History {
+		if record.Received > 0 {
+			return record.Week, record.Received
+		}
+	}
+	return -1, 0
+}
+
+// TestOrdersArriveAfterTheirDelays follows one order from the retailer to the
+// manufacturer and back, and one production order of the manufacturer. Each
+// arrives after the order delay and the shipping delay of its stage.
+func TestOrdersArriveAfterTheirDelays(t *testing.T) {
+	tests := []struct {
+		retailerShipping, retailerOrder         int
+		manufacturerShipping, manufacturerOrder int
+	}{
+		{1, 0, 1, 0},
+		{1, 1, 1, 1},
+		{2, 1, 2, 1},
+		{3, 0, 1, 3},
+		{1, 3, 3, 0},
+		{3, 3, 3, 3},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("retailer %d+%d manufacturer %d+%d", test.retailerShipping, test.retailerOrder, test.manufacturerShipping, test.manufacturerOrder)
+		t.Run(name, func(t *testing.T) {
+			stages := LinearStages(2)
+			stages[0].ShippingDelay, stages[0].OrderDelay = test.retailerShipping, test.retailerOrder
+			stages[1].ShippingDelay, stages[1].OrderDelay = test.manufacturerShipping, test.manufacturerOrder
+			initial := InitialConditions{Roles: map[int]StageConditions{2: {Stock: 100}}}
+			game := chainGame(t, "delays", stages, initial, 0)
+
+			playWeeks(t, game, []int{0, 5, 7}, 1)
+			playWeeks(t, game, []int{0, 0, 0}, 7)
+
+			if week, received := arrival(game, 1); week != test.retailerOrder+test.retailerShipping || received != 5 {
+				t.Errorf("the retailer received %d in week %d, want 5 in week %d", received, week, test.retailerOrder+test.retailerShipping)
+			}
+			if week, received := arrival(game, 2); week != test.manufacturerOrder+test.manufacturerShipping || received != 7 {
+				t.Errorf("the manufacturer produced %d in week %d, want 7 in week %d", received, week, test.manufacturerOrder+test.manufacturerShipping)
+			}
+		})
+	}
+}
+
+func TestSetDelaysOverridesOneStage(t *testing.T) {
+	game := newTestGame(t, "override", []string{"override-1"})
+	err := game.Apply(func() error {
+		if err := game.SetDelays(NONE, 3, 3); err != nil {
+			return err
+		}
+		return game.SetDelays(2, 1, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, stage := range game.Stages {
+		got += fmt.Sprintf("%d+%d ", stage.ShippingDelay, stage.OrderDelay)
+	}
+	if want := "3+3 1+0 3+3 3+3 "; got != want {
+		t.Errorf("got delays %s, want %s", got, want)
+	}
+	if err := game.Apply(func() error { return game.SetDelays(1, 0, 0) }); errorCode(err) != ERROR_INVALID_ARGUMENT {
+		t.Errorf("a shipping delay of 0 gave %v", err)
+	}
+}
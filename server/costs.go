@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+)
+
+// Money is an amount in hundredths of a currency unit, so that fractional
+// rates add up without floating point drift.
+type Money int64
+
+const MAX_RATE Money = 1000000
+
+func MoneyFromFloat(value float64) Money {
+	return Money(math.Round(value * 100))
+}
+
+func (money Money) Float() float64 {
+	return float64(money) / 100
+}
+
+// CostRates are charged to a stage every week: Holding per unit in stock,
+// Backlog per unit owed, LostSale per unit of demand lost, Order per unit
+// ordered and FixedOrder for every week with a non-zero order.
+type CostRates struct {
+	Holding    Money `json:"holding"`
+	Backlog    Money `json:"backlog"`
+	LostSale   Money `json:"lostSale"`
+	Order      Money `json:"order"`
+	FixedOrder Money `json:"fixedOrder"`
+}
+
+// CostModel applies Default to every role without an entry in Roles.
+type CostModel struct {
+	Default CostRates         `json:"default"`
+	Roles   map[int]CostRates `json:"roles"`
+}
+
+const (
+	COSTS_DEFAULT = iota
+	COSTS_CLASSIC
+)
+
+var CostModelMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "default",
+		Value: COSTS_DEFAULT,
+	},
+	NameValueMapping{
+		Name:  "classic",
+		Value: COSTS_CLASSIC,
+	},
+}
+
+// DefaultCostModel charges 1 per unit in stock and 2 per unit owed. Under a
+// lost sales policy each unit lost is charged once, like a week of backlog.
+func DefaultCostModel() CostModel {
+	return CostModel{
+		Default: CostRates{Holding: 100, Backlog: 200, LostSale: 200},
+		Roles:   map[int]CostRates{},
+	}
+}
+
+// ClassicCostModel uses the rates of the original MIT beer game, charging
+// lost sales like a week of backlog.
+func ClassicCostModel() CostModel {
+	return CostModel{
+		Default: CostRates{Holding: 50, Backlog: 100, LostSale: 100},
+		Roles:   map[int]CostRates{},
+	}
+}
+
+func (rates CostRates) Valid() bool {
+	for _, rate := range []Money{rates.Holding, rates.Backlog, rates.LostSale, rates.Order, rates.FixedOrder} {
+		if rate < 0 || rate > MAX_RATE {
+			return false
+		}
+	}
+	return true
+}
+
+type RoleCostRates struct {
+	Role  int       `json:"role"`
+	Rates CostRates `json:"rates"`
+}
+
+// RoleRates lists the per-role overrides in role order.
+func (model CostModel) RoleRates() []RoleCostRates {
+	roles := []RoleCostRates{}
+	for role := 1; role <= MAX_STAGES; role++ {
+		if rates, found := model.Roles[role]; found {
+			roles = append(roles, RoleCostRates{Role: role, Rates: rates})
+		}
+	}
+	return roles
+}
+
+func (model CostModel) Rates(role int) CostRates {
+	if rates, found := model.Roles[role]; found {
+		return rates
+	}
+	return model.Default
+}
+
+// Cost is what a stage pays for one week.
+func (rates CostRates) Cost(stock int, backlog int, lost int, order int) Money {
+	cost := Money(stock)*rates.Holding + Money(backlog)*rates.Backlog + Money(lost)*rates.LostSale + Money(order)*rates.Order
+	if order > 0 {
+		cost += rates.FixedOrder
+	}
+	return cost
+}
+
+// SetCostRates changes the rates of one role, or the default rates for NONE.
+// Setting the default also clears every per-role override.
+func (game *Game) SetCostRates(role int, rates CostRates) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !rates.Valid() {
+		return errInvalidArgument("cost rates must be between 0 and %.2f", MAX_RATE.Float())
+	}
+	if role == NONE {
+		game.Costs = CostModel{Default: rates, Roles: map[int]CostRates{}}
+		return nil
+	}
+	if !game.ValidRole(role) {
+		return errInvalidRole(role)
+	}
+	if game.Costs.Roles == nil {
+		game.Costs.Roles = map[int]CostRates{}
+	}
+	game.Costs.Roles[role] = rates
+	return nil
+}
+
+func (game *Game) SetCostModel(model int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	switch model {
+	case COSTS_DEFAULT:
+		game.Costs = DefaultCostModel()
+	case COSTS_CLASSIC:
+		game.Costs = ClassicCostModel()
+	default:
+		return errInvalidArgument("there is no cost model %d", model)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestCostsInHundredths charges fractional rates, with an override for the
+// wholesaler, over three weeks. Everyone orders 3 in the first two weeks and
+// nothing in the third, so the fixed charge applies twice.
+func TestCostsInHundredths(t *testing.T) {
+	schema := testSchema(t)
+	players := []string{"costs-1", "costs-2", "costs-3", "costs-4"}
+	game := newTestGame(t, "costs", players)
+	for _, mutation := range []string{
+		`mutation { submitCostRates(gameId: "costs", holding: 0.33, backlog: 1.17, order: 0.05, fixedOrder: 2.5) }`,
+		`mutation { submitCostRates(gameId: "costs", position: STAGE_2, holding: 0.01, backlog: 0.99, fixedOrder: 0.07) }`,
+	} {
+		if result := execute(schema, players[0], mutation); len(result.Errors) > 0 {
+			t.Fatal(result.Errors)
+		}
+	}
+	err := game.Apply(func() error {
+		game.Demand = DemandConfig{Kind: DEMAND_CONSTANT, Base: 10}
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playWeeks(t, game, []int{0, 3, 3, 3, 3}, 2)
+	playWeeks(t, game, []int{0, 0, 0, 0, 0}, 1)
+
+	// The retailer runs out in the second week. The others hold 12, 9 and
+	// 12 units.
+	want := []string{
+		"costs 26.84 costprev [4.3 12.8 26.84] history [4.3 8.5 14.04]",
+		"costs 0.47 costprev [0.19 0.35 0.47] history [0.19 0.16 0.12]",
+		"costs 16.19 costprev [6.61 12.23 16.19] history [6.61 5.62 3.96]",
+		"costs 16.19 costprev [6.61 12.23 16.19] history [6.61 5.62 3.96]",
+	}
+	for index, playerID := range players {
+		result := execute(schema, playerID, `{ playerState(gameId: "costs") { costs costprev history { cost } } }`)
+		if len(result.Errors) > 0 {
+			t.Fatal(result.Errors)
+		}
+		state := result.Data.(map[string]interface{})["playerState"].(map[string]interface{})
+		history := []interface{}{}
+		for _, record := range state["history"].([]interface{}) {
+			history = append(history, record.(map[string]interface{})["cost"])
+		}
+		got := fmt.Sprintf("costs %v costprev %v history %v", state["costs"], state["costprev"], history)
+		if got != want[index] {
+			t.Errorf("%s: got %s, want %s", game.Stage(index+1).Name, got, want[index])
+		}
+	}
+}
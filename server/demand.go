@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	DEMAND_CONSTANT = iota
+	DEMAND_STEP
+	DEMAND_UNIFORM
+	DEMAND_NORMAL
+	DEMAND_POISSON
+	DEMAND_SEASONAL
+	DEMAND_SERIES
+)
+
+var DemandModelMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "constant",
+		Value: DEMAND_CONSTANT,
+	},
+	NameValueMapping{
+		Name:  "step",
+		Value: DEMAND_STEP,
+	},
+	NameValueMapping{
+		Name:  "uniform",
+		Value: DEMAND_UNIFORM,
+	},
+	NameValueMapping{
+		Name:  "normal",
+		Value: DEMAND_NORMAL,
+	},
+	NameValueMapping{
+		Name:  "poisson",
+		Value: DEMAND_POISSON,
+	},
+	NameValueMapping{
+		Name:  "seasonal",
+		Value: DEMAND_SEASONAL,
+	},
+	NameValueMapping{
+		Name:  "series",
+		Value: DEMAND_SERIES,
+	},
+}
+
+// DemandModel produces the customer demand seen by the retailer each week.
+// Random models must draw only from rng so that seeded games are reproducible.
+type DemandModel interface {
+	Demand(week int, rng *rand.Rand) int
+}
+
+type ConstantDemand struct {
+	Value int
+}
+
+func (d ConstantDemand) Demand(week int, rng *rand.Rand) int {
+	return d.Value
+}
+
+// StepDemand is the classic beer game pattern: Before until StepWeek, then After.
+type StepDemand struct {
+	Before   int
+	After    int
+	StepWeek int
+}
+
+func (d StepDemand) Demand(week int, rng *rand.Rand) int {
+	if week < d.StepWeek {
+		return d.Before
+	}
+	return d.After
+}
+
+type UniformDemand struct {
+	Min int
+	Max int
+}
+
+func (d UniformDemand) Demand(week int, rng *rand.Rand) int {
+	return d.Min + rng.Intn(d.Max-d.Min+1)
+}
+
+type NormalDemand struct {
+	Mean   float64
+	StdDev float64
+}
+
+func (d NormalDemand) Demand(week int, rng *rand.Rand) int {
+	return nonNegative(math.Round(d.Mean + rng.NormFloat64()*d.StdDev))
+}
+
+type PoissonDemand struct {
+	Mean float64
+}
+
+func (d PoissonDemand) Demand(week int, rng *rand.Rand) int {
+	if d.Mean > 30 {
+		return nonNegative(math.Round(d.Mean + rng.NormFloat64()*math.Sqrt(d.Mean)))
+	}
+	// Knuth's method; fine for the small means used in the game.
+	limit := math.Exp(-d.Mean)
+	k := 0
+	p := rng.Float64()
+	for p > limit {
+		k++
+		p *= rng.Float64()
+	}
+	return k
+}
+
+type SeasonalDemand struct {
+	Mean      float64
+	Amplitude float64
+	Period    int
+}
+
+func (d SeasonalDemand) Demand(week int, rng *rand.Rand) int {
+	phase := 2 * math.Pi * float64(week) / float64(d.Period)
+	return nonNegative(math.Round(d.Mean + d.Amplitude*math.Sin(phase)))
+}
+
+// SeriesDemand replays a fixed sequence, repeating the last value once it runs out.
+type SeriesDemand struct {
+	Series []int
+}
+
+func (d SeriesDemand) Demand(week int, rng *rand.Rand) int {
+	if len(d.Series) == 0 {
+		return 0
+	}
+	if week >= len(d.Series) {
+		return d.Series[len(d.Series)-1]
+	}
+	return d.Series[week]
+}
+
+// nonNegative rounds a drawn demand into the range of a valid order.
+func nonNegative(value float64) int {
+	if value < 0 {
+		return 0
+	}
+	if value > MAX_ORDER {
+		return MAX_ORDER
+	}
+	return int(value)
+}
+
+// DemandConfig is the serializable description of a game's demand model.
+// Only the parameters relevant to Kind are used.
+type DemandConfig struct {
+	Kind      int     `json:"kind"`
+	Base      int     `json:"base"`
+	Step      int     `json:"step"`
+	StepWeek  int     `json:"stepWeek"`
+	Min       int     `json:"min"`
+	Max       int     `json:"max"`
+	Mean      float64 `json:"mean"`
+	StdDev    float64 `json:"stdDev"`
+	Amplitude float64 `json:"amplitude"`
+	Period    int     `json:"period"`
+	Series    []int   `json:"series"`
+}
+
+func DefaultDemandConfig() DemandConfig {
+	return DemandConfig{
+		Kind: DEMAND_UNIFORM,
+		Min:  0,
+		Max:  19,
+	}
+}
+
+// Valid checks the parameters of the model. Demand is limited like an order,
+// so every parameter must be between 0 and MAX_ORDER.
+func (config DemandConfig) Valid() bool {
+	switch config.Kind {
+	case DEMAND_CONSTANT:
+		return validDemand(config.Base)
+	case DEMAND_STEP:
+		return validDemand(config.Base) && validDemand(config.Step) && config.StepWeek >= 0
+	case DEMAND_UNIFORM:
+		return validDemand(config.Min) && validDemand(config.Max) && config.Max >= config.Min
+	case DEMAND_NORMAL:
+		return validRate(config.Mean) && validRate(config.StdDev)
+	case DEMAND_POISSON:
+		return validRate(config.Mean)
+	case DEMAND_SEASONAL:
+		return validRate(config.Mean) && validRate(math.Abs(config.Amplitude)) && config.Period > 0
+	case DEMAND_SERIES:
+		for _, value := range config.Series {
+			if !validDemand(value) {
+				return false
+			}
+		}
+		return len(config.Series) > 0
+	}
+	return false
+}
+
+func validDemand(value int) bool {
+	return value >= 0 && value <= MAX_ORDER
+}
+
+func validRate(value float64) bool {
+	return value >= 0 && value <= MAX_ORDER
+}
+
+func (config DemandConfig) Model() DemandModel {
+	switch config.Kind {
+	case DEMAND_CONSTANT:
+		return ConstantDemand{Value: config.Base}
+	case DEMAND_STEP:
+		return StepDemand{Before: config.Base, After: config.Step, StepWeek: config.StepWeek}
+	case DEMAND_NORMAL:
+		return NormalDemand{Mean: config.Mean, StdDev: config.StdDev}
+	case DEMAND_POISSON:
+		return PoissonDemand{Mean: config.Mean}
+	case DEMAND_SEASONAL:
+		return SeasonalDemand{Mean: config.Mean, Amplitude: config.Amplitude, Period: config.Period}
+	case DEMAND_SERIES:
+		return SeriesDemand{Series: config.Series}
+	}
+	return UniformDemand{Min: config.Min, Max: config.Max}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// demandSequence is the demand of a game with seed over its first weeks.
+func demandSequence(config DemandConfig, seed int64) []int {
+	game := &Game{Seed: seed}
+	model := config.Model()
+	demand := make([]int, 50)
+	for week := range demand {
+		demand[week] = model.Demand(week, game.WeekRand(week))
+	}
+	return demand
+}
+
+func TestDemandIsDeterminedBySeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DemandConfig
+		random bool
+	}{
+		{"constant", DemandConfig{Kind: DEMAND_CONSTANT, Base: 4}, false},
+		{"step", DemandConfig{Kind: DEMAND_STEP, Base: 4, Step: 8, StepWeek: 5}, false},
+		{"uniform", DemandConfig{Kind: DEMAND_UNIFORM, Min: 0, Max: 19}, true},
+		{"normal", DemandConfig{Kind: DEMAND_NORMAL, Mean: 8, StdDev: 3}, true},
+		{"poisson", DemandConfig{Kind: DEMAND_POISSON, Mean: 8}, true},
+		{"poisson with a large mean", DemandConfig{Kind: DEMAND_POISSON, Mean: 50}, true},
+		{"seasonal", DemandConfig{Kind: DEMAND_SEASONAL, Mean: 8, Amplitude: 4, Period: 12}, false},
+		{"series", DemandConfig{Kind: DEMAND_SERIES, Series: []int{4, 4, 8}}, false},
+	}
+	tested := map[int]bool{}
+	for _, test := range tests {
+		tested[test.config.Kind] = true
+	}
+	for _, mapping := range DemandModelMappings {
+		if !tested[mapping.Value] {
+			t.Errorf("no test for %s demand", mapping.Name)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.config.Valid() {
+				t.Fatalf("%+v is not valid", test.config)
+			}
+			first := demandSequence(test.config, 1)
+			if again := demandSequence(test.config, 1); !reflect.DeepEqual(first, again) {
+				t.Errorf("the same seed gave %v and then %v", first, again)
+			}
+			other := demandSequence(test.config, 2)
+			if test.random && reflect.DeepEqual(first, other) {
+				t.Errorf("seeds 1 and 2 both gave %v", first)
+			}
+			if !test.random && !reflect.DeepEqual(first, other) {
+				t.Errorf("seeds 1 and 2 gave %v and %v from a fixed pattern", first, other)
+			}
+		})
+	}
+}
+
+func TestDemandParametersAreLimited(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DemandConfig
+	}{
+		{"constant", DemandConfig{Kind: DEMAND_CONSTANT, Base: MAX_ORDER + 1}},
+		{"step before", DemandConfig{Kind: DEMAND_STEP, Base: MAX_ORDER + 1, Step: 8}},
+		{"step after", DemandConfig{Kind: DEMAND_STEP, Base: 4, Step: MAX_ORDER + 1}},
+		{"uniform", DemandConfig{Kind: DEMAND_UNIFORM, Min: 0, Max: MAX_ORDER + 1}},
+		{"normal mean", DemandConfig{Kind: DEMAND_NORMAL, Mean: 1e30, StdDev: 3}},
+		{"normal deviation", DemandConfig{Kind: DEMAND_NORMAL, Mean: 8, StdDev: 1e30}},
+		{"poisson", DemandConfig{Kind: DEMAND_POISSON, Mean: 1e30}},
+		{"seasonal mean", DemandConfig{Kind: DEMAND_SEASONAL, Mean: 1e30, Period: 12}},
+		{"seasonal amplitude", DemandConfig{Kind: DEMAND_SEASONAL, Mean: 8, Amplitude: -1e30, Period: 12}},
+		{"series", DemandConfig{Kind: DEMAND_SERIES, Series: []int{4, MAX_ORDER + 1}}},
+	}
+	for _, test := range tests {
+		if test.config.Valid() {
+			t.Errorf("%s demand %+v is valid", test.name, test.config)
+		}
+	}
+}
+
+// TestDemandStaysInOrderRange draws from models at the edge of their limits,
+// where a draw can fall outside the range of an order.
+func TestDemandStaysInOrderRange(t *testing.T) {
+	configs := []DemandConfig{
+		{Kind: DEMAND_NORMAL, Mean: MAX_ORDER, StdDev: MAX_ORDER},
+		{Kind: DEMAND_POISSON, Mean: MAX_ORDER},
+		{Kind: DEMAND_SEASONAL, Mean: MAX_ORDER, Amplitude: MAX_ORDER, Period: 4},
+	}
+	for _, config := range configs {
+		if !config.Valid() {
+			t.Fatalf("%+v is not valid", config)
+		}
+		for week, demand := range demandSequence(config, 1) {
+			if demand < 0 || demand > MAX_ORDER {
+				t.Errorf("%+v gave demand %d in week %d", config, demand, week)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Codes reported in the extensions of GraphQL errors, so clients can tell
+// failures apart without parsing messages.
+const (
+	ERROR_NOT_AUTHENTICATED = "NOT_AUTHENTICATED"
+	ERROR_PLAYER_NOT_FOUND  = "PLAYER_NOT_FOUND"
+	ERROR_PLAYER_TAKEN      = "PLAYER_TAKEN"
+	ERROR_GAME_NOT_FOUND    = "GAME_NOT_FOUND"
+	ERROR_SESSION_NOT_FOUND = "SESSION_NOT_FOUND"
+	ERROR_SESSION_TAKEN     = "SESSION_TAKEN"
+	ERROR_NOT_HOST          = "NOT_HOST"
+	ERROR_NOT_FACILITATOR   = "NOT_FACILITATOR"
+	ERROR_NOT_IN_GAME       = "NOT_IN_GAME"
+	ERROR_ALREADY_IN_GAME   = "ALREADY_IN_GAME"
+	ERROR_IN_SESSION        = "IN_SESSION"
+	ERROR_NOT_IN_LOBBY      = "NOT_IN_LOBBY"
+	ERROR_NOT_PLAYING       = "NOT_PLAYING"
+	ERROR_NOT_PAUSED        = "NOT_PAUSED"
+	ERROR_GAME_FINISHED     = "GAME_FINISHED"
+	ERROR_ROLE_TAKEN        = "ROLE_TAKEN"
+	ERROR_ROLES_INCOMPLETE  = "ROLES_INCOMPLETE"
+	ERROR_INVALID_ROLE      = "INVALID_ROLE"
+	ERROR_INVALID_ORDER     = "INVALID_ORDER"
+	ERROR_ORDER_LOCKED      = "ORDER_LOCKED"
+	ERROR_NO_ORDER          = "NO_ORDER"
+	ERROR_NO_SWAP_REQUEST   = "NO_SWAP_REQUEST"
+	ERROR_BOT               = "BOT"
+	ERROR_INVALID_ARGUMENT  = "INVALID_ARGUMENT"
+)
+
+// GameError is a failure the client can act on. graphql-go reports its code
+// under extensions.code.
+type GameError struct {
+	Code    string
+	Message string
+}
+
+func NewGameError(code string, format string, args ...interface{}) *GameError {
+	return &GameError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (err *GameError) Error() string {
+	return err.Message
+}
+
+func (err *GameError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": err.Code}
+}
+
+func errGameNotFound(gameID string) error {
+	return NewGameError(ERROR_GAME_NOT_FOUND, "no game %q", gameID)
+}
+
+func errSessionNotFound(sessionID string) error {
+	return NewGameError(ERROR_SESSION_NOT_FOUND, "no session %q", sessionID)
+}
+
+func errNotInLobby() error {
+	return NewGameError(ERROR_NOT_IN_LOBBY, "the game has already started")
+}
+
+func errNotPlaying() error {
+	return NewGameError(ERROR_NOT_PLAYING, "the game is not being played")
+}
+
+func errNotFacilitator() error {
+	return NewGameError(ERROR_NOT_FACILITATOR, "only the facilitator can do that")
+}
+
+func errInvalidRole(role int) error {
+	return NewGameError(ERROR_INVALID_ROLE, "there is no role %d", role)
+}
+
+func errInvalidArgument(format string, args ...interface{}) error {
+	return NewGameError(ERROR_INVALID_ARGUMENT, format, args...)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExportRow is one stage in one week, flattened for spreadsheets. Demand is
+// the orders the stage received; the stock, backlog and outstanding figures
+// are as the week closed.
+type ExportRow struct {
+	Week        int     `json:"week"`
+	Role        int     `json:"role"`
+	Stage       string  `json:"stage"`
+	Player      string  `json:"player"`
+	Demand      int     `json:"demand"`
+	Ordered     int     `json:"ordered"`
+	Received    int     `json:"received"`
+	Sent        int     `json:"sent"`
+	Lost        int     `json:"lost"`
+	Stock       int     `json:"stock"`
+	Backlog     int     `json:"backlog"`
+	Outstanding int     `json:"outstanding"`
+	Cost        float64 `json:"cost"`
+	TotalCost   float64 `json:"totalCost"`
+}
+
+var exportColumns = []string{"week", "role", "stage", "player", "demand", "ordered", "received", "sent", "lost", "stock", "backlog", "outstanding", "cost", "totalCost"}
+
+func (row ExportRow) columns() []string {
+	return []string{
+		strconv.Itoa(row.Week),
+		strconv.Itoa(row.Role),
+		escapeFormula(row.Stage),
+		escapeFormula(row.Player),
+		strconv.Itoa(row.Demand),
+		strconv.Itoa(row.Ordered),
+		strconv.Itoa(row.Received),
+		strconv.Itoa(row.Sent),
+		strconv.Itoa(row.Lost),
+		strconv.Itoa(row.Stock),
+		strconv.Itoa(row.Backlog),
+		strconv.Itoa(row.Outstanding),
+		strconv.FormatFloat(row.Cost, 'f', 2, 64),
+		strconv.FormatFloat(row.TotalCost, 'f', 2, 64),
+	}
+}
+
+// escapeFormula keeps spreadsheets from running names chosen by players as
+// formulas.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// Export lists every recorded week of every stage, by week and then role.
+func (game *Game) Export() []ExportRow {
+	stages, complete := game.StagePlayers()
+	if !complete {
+		return []ExportRow{}
+	}
+
+	rows := []ExportRow{}
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		for _, record := range p.HistoryRange(0, game.Week) {
+			rows = append(rows, ExportRow{
+				Week:        record.Week,
+				Role:        role,
+				Stage:       game.Stage(role).Name,
+				Player:      DisplayPlayer(p).Name,
+				Demand:      record.Incoming,
+				Ordered:     record.Ordered,
+				Received:    record.Received,
+				Sent:        record.Sent,
+				Lost:        record.Lost,
+				Stock:       record.StockAfter,
+				Backlog:     record.BacklogAfter,
+				Outstanding: record.OutstandingAfter,
+				Cost:        record.Cost.Float(),
+				TotalCost:   record.CostsAfter.Float(),
+			})
+		}
+	}
+	// Rows were gathered role by role, so a stable sort keeps roles in order.
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Week < rows[j].Week
+	})
+	return rows
+}
+
+// ExportHandler serves /export/<gameId>.csv and /export/<gameId>.json to the
+// game's host.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	extension := path.Ext(name)
+	game := FindGame(strings.TrimSuffix(name, extension))
+	if game == nil {
+		http.NotFound(w, r)
+		return
+	}
+	game = game.Snapshot()
+	if !game.IsHost(DownloadPlayer(r)) {
+		http.Error(w, "only the host can export a game", http.StatusForbidden)
+		return
+	}
+
+	rows := game.Export()
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": game.ID + extension})
+	switch extension {
+	case ".csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", disposition)
+		writer := csv.NewWriter(w)
+		writer.Write(exportColumns)
+		for _, row := range rows {
+			writer.Write(row.columns())
+		}
+		writer.Flush()
+	case ".json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", disposition)
+		json.NewEncoder(w).Encode(rows)
+	default:
+		http.NotFound(w, r)
+	}
+}
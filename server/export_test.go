@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestExportOrdersRowsByWeekThenRole(t *testing.T) {
+	players := []string{"export-1", "export-2", "export-3", "export-4"}
+	game := newTestGame(t, "export", players)
+	game.Apply(game.Start)
+	game.Apply(game.ForceStep)
+	game.Apply(game.ForceStep)
+
+	rows := game.Snapshot().Export()
+	if len(rows) != 2*len(players) {
+		t.Fatalf("got %d rows, want %d", len(rows), 2*len(players))
+	}
+	for index, row := range rows {
+		if week, role := index/len(players), index%len(players)+1; row.Week != week || row.Role != role {
+			t.Errorf("row %d is week %d role %d, want week %d role %d", index, row.Week, row.Role, week, role)
+		}
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"Retailer", "Retailer"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"a=b", "a=b"},
+	}
+	for _, test := range tests {
+		if got := escapeFormula(test.cell); got != test.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", test.cell, got, test.want)
+		}
+	}
+}
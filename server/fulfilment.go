@@ -0,0 +1,63 @@
+package main
+
+// The fulfilment policy decides what happens to demand a stage cannot meet
+// from stock. It is either backlogged and shipped later, or lost.
+
+const (
+	FULFILMENT_BACKLOG = iota
+	FULFILMENT_LOST_SALES_RETAIL
+	FULFILMENT_LOST_SALES
+)
+
+var FulfilmentMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "backlog",
+		Value: FULFILMENT_BACKLOG,
+	},
+	NameValueMapping{
+		Name:  "lost sales at retail",
+		Value: FULFILMENT_LOST_SALES_RETAIL,
+	},
+	NameValueMapping{
+		Name:  "lost sales",
+		Value: FULFILMENT_LOST_SALES,
+	},
+}
+
+// LosesSales reports whether unmet orders to role are discarded at the end
+// of the week instead of backlogged.
+func (game *Game) LosesSales(role int) bool {
+	switch game.Fulfilment {
+	case FULFILMENT_LOST_SALES_RETAIL:
+		return game.SellsToMarket(role)
+	case FULFILMENT_LOST_SALES:
+		return true
+	}
+	return false
+}
+
+func (game *Game) SetFulfilment(policy int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if policy < 0 || policy >= len(FulfilmentMappings) {
+		return errInvalidArgument("there is no fulfilment policy %d", policy)
+	}
+	game.Fulfilment = policy
+	return nil
+}
+
+// loseSales discards everything p still owes its customers and returns the
+// number of units lost. Customer stages stop waiting for the lost goods.
+func (game *Game) loseSales(p *PlayerState, stages []*PlayerState) int {
+	lost := 0
+	for customer, owed := range p.CustomerBacklog {
+		lost += owed
+		if customer != MARKET {
+			stages[customer].Outstanding -= owed
+		}
+	}
+	p.CustomerBacklog = map[int]int{}
+	p.Backlog -= lost
+	return lost
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestLostSalesArePenalised has the retailer lose sales under the default
+// costs: 5 units in the first week and all 20 in the second.
+func TestLostSalesArePenalised(t *testing.T) {
+	schema := testSchema(t)
+	players := []string{"lost-1", "lost-2", "lost-3", "lost-4"}
+	game := newTestGame(t, "lost", players)
+	err := game.Apply(func() error {
+		if err := game.SetFulfilment(FULFILMENT_LOST_SALES_RETAIL); err != nil {
+			return err
+		}
+		game.Demand = DemandConfig{Kind: DEMAND_CONSTANT, Base: 20}
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playWeeks(t, game, []int{0, 0, 0, 0, 0}, 2)
+
+	result := execute(schema, players[0], `{ playerState(gameId: "lost") { costs backlog lostsales history { lost cost } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	got := fmt.Sprint(result.Data)
+	want := "map[playerState:map[backlog:0 costs:50 history:[map[cost:10 lost:5] map[cost:40 lost:20]] lostsales:[5 20]]]"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -6,5 +6,6 @@ require (
 	github.com/graphql-go/graphql v0.7.9
 	github.com/graphql-go/handler v0.2.3
 	github.com/rs/cors v1.7.0
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/net v0.0.0-20210220033124-5f55cee0dc0d
 )
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// WeekRecord is one stage's ledger entry for one week. The Before fields are
+// the stage as the week opened, the After fields as it closed.
+type WeekRecord struct {
+	Week     int   `json:"week"`
+	Incoming int   `json:"incoming"`
+	Ordered  int   `json:"ordered"`
+	Received int   `json:"received"`
+	Sent     int   `json:"sent"`
+	Lost     int   `json:"lost"`
+	Cost     Money `json:"cost"`
+
+	StockBefore       int   `json:"stockBefore"`
+	BacklogBefore     int   `json:"backlogBefore"`
+	OutstandingBefore int   `json:"outstandingBefore"`
+	CostsBefore       Money `json:"costsBefore"`
+
+	StockAfter       int   `json:"stockAfter"`
+	BacklogAfter     int   `json:"backlogAfter"`
+	OutstandingAfter int   `json:"outstandingAfter"`
+	CostsAfter       Money `json:"costsAfter"`
+}
+
+func openWeekRecord(week int, p *PlayerState) WeekRecord {
+	return WeekRecord{
+		Week:              week,
+		Ordered:           p.Outgoing,
+		StockBefore:       p.Stock,
+		BacklogBefore:     p.Backlog,
+		OutstandingBefore: p.Outstanding,
+		CostsBefore:       p.Costs,
+	}
+}
+
+func (record *WeekRecord) close(p *PlayerState) {
+	record.Incoming = p.Incoming
+	record.StockAfter = p.Stock
+	record.BacklogAfter = p.Backlog
+	record.OutstandingAfter = p.Outstanding
+	record.CostsAfter = p.Costs
+	record.Cost = p.Costs - record.CostsBefore
+}
+
+// HistoryRange returns the records for weeks from to to inclusive. A
+// negative bound is open.
+func (p *PlayerState) HistoryRange(from int, to int) []WeekRecord {
+	records := []WeekRecord{}
+	for _, record := range p.History {
+		if (from < 0 || record.Week >= from) && (to < 0 || record.Week <= to) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// WeekSnapshot is every stage as a week opened. The history fields are left
+// out, since on rewind the current history is cut back to the week instead.
+type WeekSnapshot struct {
+	Week        int            `json:"week"`
+	PlayerState []*PlayerState `json:"playerState"`
+}
+
+// copyWithoutHistory deep copies p, leaving out its history.
+func copyWithoutHistory(p *PlayerState) *PlayerState {
+	trimmed := *p
+	trimmed.OutgoingPrev = nil
+	trimmed.StockBackPrev = nil
+	trimmed.CostPrev = nil
+	trimmed.LostSales = nil
+	trimmed.History = nil
+	data, err := json.Marshal(&trimmed)
+	if err != nil {
+		panic(err)
+	}
+	copied := &PlayerState{}
+	if err := json.Unmarshal(data, copied); err != nil {
+		panic(err)
+	}
+	return copied
+}
+
+func (game *Game) recordSnapshot() {
+	snapshot := WeekSnapshot{Week: game.Week, PlayerState: []*PlayerState{}}
+	for _, playerState := range game.PlayerState {
+		snapshot.PlayerState = append(snapshot.PlayerState, copyWithoutHistory(playerState))
+	}
+	game.Snapshots = append(game.Snapshots, snapshot)
+}
+
+// RewindWeeks lists the weeks the game can be rewound to.
+func (game *Game) RewindWeeks() []int {
+	weeks := []int{}
+	for _, snapshot := range game.Snapshots {
+		weeks = append(weeks, snapshot.Week)
+	}
+	return weeks
+}
+
+// Rewind restores every stage to how it was as week opened, and pauses the
+// game so the host can resume it when ready.
+func (game *Game) Rewind(week int) error {
+	if game.State == LOBBY {
+		return NewGameError(ERROR_NOT_PLAYING, "the game has not started")
+	}
+	for index, snapshot := range game.Snapshots {
+		if snapshot.Week != week {
+			continue
+		}
+
+		restored := []*PlayerState{}
+		for _, saved := range snapshot.PlayerState {
+			playerState := copyWithoutHistory(saved)
+			if current := game.FindPlayerState(saved.PlayerID); current != nil {
+				playerState.restoreHistory(current, week)
+			}
+			restored = append(restored, playerState)
+		}
+		game.PlayerState = restored
+		game.Week = week
+		game.Snapshots = game.Snapshots[:index+1]
+		game.Debrief = nil
+		game.State = PAUSED
+		game.scheduleTurn()
+		return nil
+	}
+	return errInvalidArgument("the game cannot be rewound to week %d", week)
+}
+
+// restoreHistory takes the history of current from before week.
+func (p *PlayerState) restoreHistory(current *PlayerState, week int) {
+	p.OutgoingPrev = append([]int{}, current.OutgoingPrev[:minInt(week, len(current.OutgoingPrev))]...)
+	p.StockBackPrev = append([]int{}, current.StockBackPrev[:minInt(week, len(current.StockBackPrev))]...)
+	p.CostPrev = append([]Money{}, current.CostPrev[:minInt(week, len(current.CostPrev))]...)
+	p.LostSales = append([]int{}, current.LostSales[:minInt(week, len(current.LostSales))]...)
+	p.History = []WeekRecord{}
+	for _, record := range current.History {
+		if record.Week < week {
+			p.History = append(p.History, record)
+		}
+	}
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
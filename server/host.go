@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// The host is the player who created the game. Only the host may configure,
+// start, pause, advance or end it, and remove or reassign other players.
+
+func (game *Game) IsHost(playerID string) bool {
+	return playerID != "" && game.HostID == playerID
+}
+
+func (game *Game) Pause() error {
+	if game.State != PLAYING {
+		return errNotPlaying()
+	}
+	game.State = PAUSED
+	game.scheduleTurn()
+	return nil
+}
+
+func (game *Game) Resume() error {
+	if game.State != PAUSED {
+		return NewGameError(ERROR_NOT_PAUSED, "the game is not paused")
+	}
+	game.State = PLAYING
+	game.TryStep()
+	game.scheduleTurn()
+	return nil
+}
+
+// ForceStep advances the week even if some players have not locked in their
+// orders. Their pending orders are locked in, and those without one are
+// given their default order.
+func (game *Game) ForceStep() error {
+	if game.State != PLAYING {
+		return errNotPlaying()
+	}
+	for _, playerState := range game.PlayerState {
+		if playerState.Ready {
+			continue
+		}
+		if playerState.Outgoing == -1 {
+			playerState.Outgoing = game.DefaultOrder(playerState)
+		}
+		playerState.Ready = true
+	}
+	game.TryStep()
+	return nil
+}
+
+func (game *Game) End() error {
+	if game.State != PLAYING && game.State != PAUSED {
+		return errNotPlaying()
+	}
+	game.finish()
+	game.scheduleTurn()
+	return nil
+}
+
+// updateAsHost runs update on the game named by the gameId argument if the
+// acting player is its host.
+func updateAsHost(p graphql.ResolveParams, update func(game *Game) error) (interface{}, error) {
+	gameId, _ := p.Args["gameId"].(string)
+	game := FindGame(gameId)
+	if game == nil {
+		return nil, errGameNotFound(gameId)
+	}
+
+	playerId := ActingPlayer(p.Context)
+	err := game.Apply(func() error {
+		if !game.IsHost(playerId) {
+			return NewGameError(ERROR_NOT_HOST, "only the host can do that")
+		}
+		return update(game)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// updateAsPlayer runs update on the game named by the gameId argument for the
+// acting player.
+func updateAsPlayer(p graphql.ResolveParams, update func(game *Game, playerId string) error) (interface{}, error) {
+	gameId, _ := p.Args["gameId"].(string)
+	game := FindGame(gameId)
+	if game == nil {
+		return nil, errGameNotFound(gameId)
+	}
+
+	playerId := ActingPlayer(p.Context)
+	if playerId == "" {
+		return nil, NewGameError(ERROR_NOT_AUTHENTICATED, "sign in to play")
+	}
+	if err := game.Apply(func() error { return update(game, playerId) }); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRemovingHostPassesItOn(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []string
+		remove  string
+		host    string
+	}{
+		{"player leaves", []string{"host-1", "host-2"}, "host-2", "host-1"},
+		{"host leaves", []string{"host-1", "host-2"}, "host-1", "host-2"},
+		{"only bots are left", []string{"host-1"}, "host-1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := newTestGame(t, "host", test.players)
+			err := game.Apply(func() error {
+				if err := game.AddBot(len(test.players)+1, 0); err != nil {
+					return err
+				}
+				return game.RemovePlayer(test.remove)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game.HostID != test.host {
+				t.Errorf("got host %q, want %q", game.HostID, test.host)
+			}
+		})
+	}
+}
+
+func TestJoiningHostlessGameHostsIt(t *testing.T) {
+	schema := testSchema(t)
+	gamesLock.Lock()
+	delete(Games, "hostless")
+	gamesLock.Unlock()
+	CreatePlayer("hostless-1", "First")
+	CreatePlayer("hostless-2", "Second")
+	execute(schema, "hostless-1", `mutation { addPlayer(gameId: "hostless") }`)
+	execute(schema, "hostless-1", `mutation { removePlayer(gameId: "hostless", playerId: "hostless-1") }`)
+	game := FindGame("hostless")
+	if game.HostID != "" {
+		t.Fatalf("got host %q after everyone left, want none", game.HostID)
+	}
+
+	result := execute(schema, "hostless-2", `mutation { addPlayer(gameId: "hostless") }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	if game.HostID != "hostless-2" {
+		t.Errorf("got host %q, want the player who joined", game.HostID)
+	}
+}
+
+func TestHostRemovesPlayersMidGame(t *testing.T) {
+	schema := testSchema(t)
+	players := []string{"kick-1", "kick-2", "kick-3", "kick-4"}
+	for _, playerID := range append(players, "kick-5") {
+		CreatePlayer(playerID, playerID)
+	}
+	game := newTestGame(t, "kick", players)
+	err := game.Apply(func() error {
+		if err := game.SetSeats(2); err != nil {
+			return err
+		}
+		if err := game.AddPlayer("kick-5"); err != nil {
+			return err
+		}
+		if err := game.AssignRole("kick-5", 2); err != nil {
+			return err
+		}
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove := func(actingID string, playerID string) []string {
+		result := execute(schema, actingID, `mutation { removePlayer(gameId: "kick", playerId: "`+playerID+`") }`)
+		codes := []string{}
+		for _, err := range result.Errors {
+			codes = append(codes, fmt.Sprint(err.Extensions["code"]))
+		}
+		return codes
+	}
+	if codes := remove("kick-3", "kick-3"); len(codes) != 1 || codes[0] != "NOT_HOST" {
+		t.Errorf("player left mid-game with errors %v, want NOT_HOST", codes)
+	}
+	if codes := remove("kick-1", "kick-4"); len(codes) > 0 {
+		t.Fatal(codes)
+	}
+	if codes := remove("kick-1", "kick-2"); len(codes) > 0 {
+		t.Fatal(codes)
+	}
+
+	if bot := game.Holder(4); bot.Bot == nil || bot.PlayerID != BotID(4) {
+		t.Errorf("role 4 is held by %q, want a bot", bot.PlayerID)
+	}
+	if holder := game.Holder(2); holder.PlayerID != "kick-5" || len(holder.CoManagers) > 0 {
+		t.Errorf("role 2 is held by %q with %v, want the co-manager alone", holder.PlayerID, holder.CoManagers)
+	}
+	for _, playerID := range []string{"kick-1", "kick-5", "kick-3"} {
+		execute(schema, playerID, `mutation { submitOutgoing(gameId: "kick", outgoing: 4) }`)
+		execute(schema, playerID, `mutation { lockOrder(gameId: "kick") }`)
+	}
+	if week := game.Snapshot().Week; week != 1 {
+		t.Errorf("got week %d once the remaining players locked in, want 1", week)
+	}
+}
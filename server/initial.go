@@ -0,0 +1,168 @@
+package main
+
+// StageConditions describe a stage when the game starts: units in stock,
+// units owed to each customer, and units in each slot of the shipment and
+// order pipelines.
+type StageConditions struct {
+	Stock    int `json:"stock"`
+	Backlog  int `json:"backlog"`
+	Shipment int `json:"shipment"`
+	Order    int `json:"order"`
+}
+
+// InitialConditions applies Default to every role without an entry in Roles.
+type InitialConditions struct {
+	Default StageConditions         `json:"default"`
+	Roles   map[int]StageConditions `json:"roles"`
+}
+
+const MAX_INITIAL = 1000
+
+// The classic game ships in two weeks and takes a week to pass an order on.
+const (
+	CLASSIC_SHIPPING_DELAY = 2
+	CLASSIC_ORDER_DELAY    = 1
+)
+
+const (
+	INITIAL_DEFAULT = iota
+	INITIAL_CLASSIC
+)
+
+var InitialConditionsMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "default",
+		Value: INITIAL_DEFAULT,
+	},
+	NameValueMapping{
+		Name:  "classic",
+		Value: INITIAL_CLASSIC,
+	},
+}
+
+// DefaultInitialConditions start every stage with 15 in stock and nothing
+// on the way.
+func DefaultInitialConditions() InitialConditions {
+	return InitialConditions{
+		Default: StageConditions{Stock: 15},
+		Roles:   map[int]StageConditions{},
+	}
+}
+
+// ClassicInitialConditions are the steady state of the MIT beer game: 12 on
+// hand and 4 in every pipeline slot. Orders only fill the order pipeline of
+// stages with an order delay.
+func ClassicInitialConditions() InitialConditions {
+	return InitialConditions{
+		Default: StageConditions{Stock: 12, Shipment: 4, Order: 4},
+		Roles:   map[int]StageConditions{},
+	}
+}
+
+func (conditions StageConditions) Valid() bool {
+	for _, value := range []int{conditions.Stock, conditions.Backlog, conditions.Shipment, conditions.Order} {
+		if value < 0 || value > MAX_INITIAL {
+			return false
+		}
+	}
+	return true
+}
+
+func (initial InitialConditions) Conditions(role int) StageConditions {
+	if conditions, found := initial.Roles[role]; found {
+		return conditions
+	}
+	return initial.Default
+}
+
+type RoleStageConditions struct {
+	Role       int             `json:"role"`
+	Conditions StageConditions `json:"conditions"`
+}
+
+// RoleConditions lists the per-role overrides in role order.
+func (initial InitialConditions) RoleConditions() []RoleStageConditions {
+	roles := []RoleStageConditions{}
+	for role := 1; role <= MAX_STAGES; role++ {
+		if conditions, found := initial.Roles[role]; found {
+			roles = append(roles, RoleStageConditions{Role: role, Conditions: conditions})
+		}
+	}
+	return roles
+}
+
+// SetStageConditions changes the conditions of one role, or the default
+// conditions for NONE. Setting the default clears every per-role override.
+func (game *Game) SetStageConditions(role int, conditions StageConditions) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !conditions.Valid() {
+		return errInvalidArgument("starting conditions must be between 0 and %d", MAX_INITIAL)
+	}
+	if role == NONE {
+		game.Initial = InitialConditions{Default: conditions, Roles: map[int]StageConditions{}}
+		return nil
+	}
+	if !game.ValidRole(role) {
+		return errInvalidRole(role)
+	}
+	if game.Initial.Roles == nil {
+		game.Initial.Roles = map[int]StageConditions{}
+	}
+	game.Initial.Roles[role] = conditions
+	return nil
+}
+
+func (game *Game) SetInitialConditions(preset int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	switch preset {
+	case INITIAL_DEFAULT:
+		game.Initial = DefaultInitialConditions()
+	case INITIAL_CLASSIC:
+		game.Initial = ClassicInitialConditions()
+		game.SetDelays(NONE, CLASSIC_SHIPPING_DELAY, CLASSIC_ORDER_DELAY)
+	default:
+		return errInvalidArgument("there is no initial conditions preset %d", preset)
+	}
+	return nil
+}
+
+// applyInitialConditions sets up every stage for week 0. Each customer is
+// owed the initial backlog, and expects everything in its pipelines and its
+// supplier's backlog to arrive eventually.
+func (game *Game) applyInitialConditions(stages []*PlayerState) {
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		stage := game.Stage(role)
+		conditions := game.Initial.Conditions(role)
+
+		p.Stock = conditions.Stock
+		p.CustomerBacklog = map[int]int{}
+		p.Backlog = 0
+		customers := game.Customers(role)
+		if len(customers) == 0 {
+			customers = []int{MARKET}
+		}
+		for _, customer := range customers {
+			p.CustomerBacklog[customer] = conditions.Backlog
+			p.Backlog += conditions.Backlog
+		}
+
+		p.Shipments = make(Pipeline, stage.ShippingDelay)
+		for index := range p.Shipments {
+			p.Shipments[index] = conditions.Shipment
+		}
+		p.Orders = make(Pipeline, stage.OrderDelay)
+		for index := range p.Orders {
+			p.Orders[index] = conditions.Order
+		}
+
+		p.Outstanding = stage.ShippingDelay*conditions.Shipment + stage.OrderDelay*conditions.Order
+		if stage.Supplier != NONE {
+			p.Outstanding += game.Initial.Conditions(stage.Supplier).Backlog
+		}
+	}
+}
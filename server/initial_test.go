@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClassicPresetFillsEveryPipeline(t *testing.T) {
+	players := []string{"classic-1", "classic-2", "classic-3", "classic-4"}
+	game := newTestGame(t, "classic", players)
+	err := game.Apply(func() error {
+		if err := game.SetInitialConditions(INITIAL_CLASSIC); err != nil {
+			return err
+		}
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range game.Snapshot().PlayerState {
+		got := fmt.Sprintf("stock %d, shipments %v, orders %v, outstanding %d", p.Stock, p.Shipments, p.Orders, p.Outstanding)
+		if want := "stock 12, shipments [4 4], orders [4], outstanding 12"; got != want {
+			t.Errorf("%s starts with %s, want %s", game.Stage(p.Role).Name, got, want)
+		}
+	}
+}
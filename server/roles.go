@@ -0,0 +1,249 @@
+package main
+
+// Each role is run by one player, or by up to Seats players if the host lets
+// several humans co-manage a stage. The first to claim a role holds it: the
+// stage carries their id and the others are listed as its co-managers. In the
+// lobby players trade roles by asking each other to swap.
+
+const MAX_SEATS = 4
+
+type SwapRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Seated reports whether playerID holds or co-manages the stage.
+func (p *PlayerState) Seated(playerID string) bool {
+	if p.PlayerID == playerID {
+		return true
+	}
+	for _, coManager := range p.CoManagers {
+		if coManager == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (game *Game) SetSeats(seats int) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if seats < 1 || seats > MAX_SEATS {
+		return errInvalidArgument("roles have 1 to %d seats", MAX_SEATS)
+	}
+	for _, playerState := range game.PlayerState {
+		if 1+len(playerState.CoManagers) > seats {
+			return errInvalidArgument("the %s already has more players", game.Stage(playerState.Role).Name)
+		}
+	}
+	game.Seats = seats
+	return nil
+}
+
+// Holder returns the stage playing role, or nil if nobody has claimed it.
+func (game *Game) Holder(role int) *PlayerState {
+	for _, playerState := range game.PlayerState {
+		if playerState.Role == role {
+			return playerState
+		}
+	}
+	return nil
+}
+
+// OpenRoles lists the roles that still have a free seat.
+func (game *Game) OpenRoles() []int {
+	roles := []int{}
+	for role := 1; role <= len(game.Stages); role++ {
+		holder := game.Holder(role)
+		if holder == nil || (holder.Bot == nil && 1+len(holder.CoManagers) < game.Seats) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// unseat takes playerID out of their role and returns their own stage, which
+// is left without a role. A holder hands the role to the first co-manager.
+// Only players in the lobby are unseated, so no stage has any history yet.
+func (game *Game) unseat(playerID string) *PlayerState {
+	game.dropSwapRequests(playerID)
+	playerState := game.FindPlayerState(playerID)
+	if playerState.PlayerID == playerID && len(playerState.CoManagers) == 0 {
+		playerState.Role = NONE
+		return playerState
+	}
+
+	playerState.leave(playerID)
+	own := newPlayerState(playerID)
+	game.PlayerState = append(game.PlayerState, own)
+	return own
+}
+
+// leave takes playerID off a stage that others also run. A holder hands the
+// stage to the first co-manager.
+func (p *PlayerState) leave(playerID string) {
+	if p.PlayerID == playerID {
+		p.PlayerID = p.CoManagers[0]
+		p.CoManagers = p.CoManagers[1:]
+		return
+	}
+	coManagers := []string{}
+	for _, coManager := range p.CoManagers {
+		if coManager != playerID {
+			coManagers = append(coManagers, coManager)
+		}
+	}
+	p.CoManagers = coManagers
+}
+
+// vacate takes playerID off their stage in a game that has started. A stage
+// nobody else runs is handed to a base stock bot, which orders if the player
+// had not locked in this week's order.
+func (game *Game) vacate(playerState *PlayerState, playerID string) {
+	if playerState.PlayerID != playerID || len(playerState.CoManagers) > 0 {
+		playerState.leave(playerID)
+		return
+	}
+	playerState.PlayerID = BotID(playerState.Role)
+	playerState.Bot = &Bot{Strategy: STRATEGY_BASE_STOCK, Forecast: float64(playerState.Incoming)}
+	game.TryStep()
+}
+
+// seat gives the role, or a seat at it, to the player of own, a stage
+// without a role.
+func (game *Game) seat(own *PlayerState, role int) {
+	holder := game.Holder(role)
+	if role == NONE || holder == nil {
+		own.Role = role
+		return
+	}
+	for index, playerState := range game.PlayerState {
+		if playerState == own {
+			game.PlayerState = append(game.PlayerState[:index], game.PlayerState[index+1:]...)
+			break
+		}
+	}
+	holder.CoManagers = append(holder.CoManagers, own.PlayerID)
+}
+
+// hasSeat reports whether a player could join role.
+func (game *Game) hasSeat(role int) error {
+	holder := game.Holder(role)
+	if holder == nil {
+		return nil
+	}
+	if holder.Bot != nil || 1+len(holder.CoManagers) >= game.Seats {
+		return NewGameError(ERROR_ROLE_TAKEN, "the %s is already played", game.Stage(role).Name)
+	}
+	return nil
+}
+
+// lobbyPlayer returns the stage of a human player in the lobby.
+func (game *Game) lobbyPlayer(playerID string) (*PlayerState, error) {
+	if game.State != LOBBY {
+		return nil, errNotInLobby()
+	}
+	playerState := game.FindPlayerState(playerID)
+	if playerState == nil {
+		return nil, NewGameError(ERROR_NOT_IN_GAME, "%s is not in the game", playerID)
+	}
+	if playerState.Bot != nil {
+		return nil, NewGameError(ERROR_BOT, "bots cannot change role")
+	}
+	return playerState, nil
+}
+
+// AssignRole gives a player in the lobby a role, or none, if it has a free
+// seat.
+func (game *Game) AssignRole(playerID string, role int) error {
+	playerState, err := game.lobbyPlayer(playerID)
+	if err != nil {
+		return err
+	}
+	if role != NONE && !game.ValidRole(role) {
+		return errInvalidRole(role)
+	}
+	if playerState.Role == role {
+		return nil
+	}
+	if role != NONE {
+		if err := game.hasSeat(role); err != nil {
+			return err
+		}
+	}
+	game.seat(game.unseat(playerID), role)
+	return nil
+}
+
+// RequestSwap asks to trade roles with another player.
+func (game *Game) RequestSwap(from string, to string) error {
+	fromState, err := game.lobbyPlayer(from)
+	if err != nil {
+		return err
+	}
+	toState, err := game.lobbyPlayer(to)
+	if err != nil {
+		return err
+	}
+	if fromState.Role == toState.Role {
+		return errInvalidArgument("%s and %s already share a role", from, to)
+	}
+	for _, request := range game.SwapRequests {
+		if request.From == from && request.To == to {
+			return nil
+		}
+	}
+	game.SwapRequests = append(game.SwapRequests, SwapRequest{From: from, To: to})
+	return nil
+}
+
+// AnswerSwap accepts or declines the request from from to to.
+func (game *Game) AnswerSwap(to string, from string, accept bool) error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	if !game.removeSwapRequest(from, to) {
+		return NewGameError(ERROR_NO_SWAP_REQUEST, "%s has not asked to swap with %s", from, to)
+	}
+	if !accept {
+		return nil
+	}
+
+	fromRole := game.FindPlayerState(from).Role
+	toRole := game.FindPlayerState(to).Role
+	fromOwn := game.unseat(from)
+	toOwn := game.unseat(to)
+	game.seat(fromOwn, toRole)
+	game.seat(toOwn, fromRole)
+	return nil
+}
+
+func (game *Game) CancelSwap(from string, to string) error {
+	if !game.removeSwapRequest(from, to) {
+		return NewGameError(ERROR_NO_SWAP_REQUEST, "%s has not asked to swap with %s", from, to)
+	}
+	return nil
+}
+
+func (game *Game) removeSwapRequest(from string, to string) bool {
+	for index, request := range game.SwapRequests {
+		if request.From == from && request.To == to {
+			game.SwapRequests = append(game.SwapRequests[:index], game.SwapRequests[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// dropSwapRequests forgets the requests to and from a player whose role is
+// about to change.
+func (game *Game) dropSwapRequests(playerID string) {
+	requests := []SwapRequest{}
+	for _, request := range game.SwapRequests {
+		if request.From != playerID && request.To != playerID {
+			requests = append(requests, request)
+		}
+	}
+	game.SwapRequests = requests
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type assignment struct {
+	player string
+	role   int
+}
+
+// seatedLobby returns a lobby with two seats per role, players a, b and c,
+// and the roles assigned in order.
+func seatedLobby(t *testing.T, assignments []assignment) *Game {
+	game := newTestGame(t, "roles", []string{"a", "b", "c"})
+	err := game.Apply(func() error {
+		for _, player := range []string{"a", "b", "c"} {
+			if err := game.AssignRole(player, NONE); err != nil {
+				return err
+			}
+		}
+		if err := game.SetSeats(2); err != nil {
+			return err
+		}
+		for _, assigned := range assignments {
+			if err := game.AssignRole(assigned.player, assigned.role); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+// seating describes who plays each role, as role:holder+co-managers.
+func seating(game *Game) string {
+	stages := []string{}
+	for _, playerState := range game.PlayerState {
+		players := append([]string{playerState.PlayerID}, playerState.CoManagers...)
+		stages = append(stages, fmt.Sprintf("%d:%s", playerState.Role, strings.Join(players, "+")))
+	}
+	sort.Strings(stages)
+	return strings.Join(stages, " ")
+}
+
+func errorCode(err error) string {
+	if gameError, ok := err.(*GameError); ok {
+		return gameError.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestAssignRoleWithSeats(t *testing.T) {
+	tests := []struct {
+		name     string
+		assigned []assignment
+		assign   assignment
+		seating  string
+		code     string
+	}{
+		{"free role", nil, assignment{"a", 1}, "0:b 0:c 1:a", ""},
+		{"co-manage", []assignment{{"a", 1}}, assignment{"b", 1}, "0:c 1:a+b", ""},
+		{"no seat left", []assignment{{"a", 1}, {"b", 1}}, assignment{"c", 1}, "0:c 1:a+b", ERROR_ROLE_TAKEN},
+		{"holder moves on", []assignment{{"a", 1}, {"b", 1}}, assignment{"a", 2}, "0:c 1:b 2:a", ""},
+		{"co-manager leaves", []assignment{{"a", 1}, {"b", 1}}, assignment{"b", NONE}, "0:b 0:c 1:a", ""},
+		{"co-manager moves on", []assignment{{"a", 1}, {"b", 1}, {"c", 2}}, assignment{"b", 2}, "1:a 2:c+b", ""},
+		{"invalid role", nil, assignment{"a", 9}, "0:a 0:b 0:c", ERROR_INVALID_ROLE},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := seatedLobby(t, test.assigned)
+			err := game.Apply(func() error { return game.AssignRole(test.assign.player, test.assign.role) })
+			if code := errorCode(err); code != test.code {
+				t.Errorf("got error %q, want %q", code, test.code)
+			}
+			if got := seating(game); got != test.seating {
+				t.Errorf("got %s, want %s", got, test.seating)
+			}
+		})
+	}
+}
+
+func TestAnswerSwapWithSeats(t *testing.T) {
+	assigned := []assignment{{"a", 1}, {"b", 1}, {"c", 2}}
+	tests := []struct {
+		name    string
+		request *SwapRequest
+		answer  SwapRequest
+		accept  bool
+		seating string
+		code    string
+	}{
+		{"holder swaps", &SwapRequest{"c", "a"}, SwapRequest{"c", "a"}, true, "1:b+c 2:a", ""},
+		{"co-manager swaps", &SwapRequest{"b", "c"}, SwapRequest{"b", "c"}, true, "1:a+c 2:b", ""},
+		{"declined", &SwapRequest{"c", "a"}, SwapRequest{"c", "a"}, false, "1:a+b 2:c", ""},
+		{"not asked", nil, SwapRequest{"c", "a"}, true, "1:a+b 2:c", ERROR_NO_SWAP_REQUEST},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := seatedLobby(t, assigned)
+			err := game.Apply(func() error {
+				if test.request != nil {
+					if err := game.RequestSwap(test.request.From, test.request.To); err != nil {
+						return err
+					}
+				}
+				return game.AnswerSwap(test.answer.To, test.answer.From, test.accept)
+			})
+			if code := errorCode(err); code != test.code {
+				t.Errorf("got error %q, want %q", code, test.code)
+			}
+			if got := seating(game); got != test.seating {
+				t.Errorf("got %s, want %s", got, test.seating)
+			}
+			if len(game.SwapRequests) != 0 {
+				t.Errorf("swap requests %v were left over", game.SwapRequests)
+			}
+		})
+	}
+}
+
+func TestRemovePlayerWithSeats(t *testing.T) {
+	tests := []struct {
+		name      string
+		remove    string
+		requester string
+		seating   string
+	}{
+		{"holder", "a", "c", "1:b 2:c"},
+		{"co-manager", "b", "c", "1:a 2:c"},
+		{"sole holder", "c", "a", "1:a+b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := seatedLobby(t, []assignment{{"a", 1}, {"b", 1}, {"c", 2}})
+			err := game.Apply(func() error {
+				if err := game.RequestSwap(test.requester, test.remove); err != nil {
+					return err
+				}
+				return game.RemovePlayer(test.remove)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := seating(game); got != test.seating {
+				t.Errorf("got %s, want %s", got, test.seating)
+			}
+			if game.FindPlayerState(test.remove) != nil {
+				t.Errorf("%s is still in the game", test.remove)
+			}
+			if len(game.SwapRequests) != 0 {
+				t.Errorf("swap requests %v were left over", game.SwapRequests)
+			}
+		})
+	}
+}
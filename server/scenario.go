@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Scenario is a set of settings applied to every game of a session as it
+// starts. Nil fields keep each game's own setting, except Seed: without one
+// a fresh seed is shared, so that every team faces the same demand.
+type Scenario struct {
+	LastWeek   *int
+	Seed       *int64
+	Demand     *DemandConfig
+	CostModel  *int
+	Initial    *int
+	Fulfilment *int
+}
+
+func (scenario Scenario) Valid() bool {
+	if scenario.LastWeek != nil && !ValidLastWeek(*scenario.LastWeek) {
+		return false
+	}
+	if scenario.Seed != nil && *scenario.Seed < 0 {
+		return false
+	}
+	if scenario.Demand != nil && !scenario.Demand.Valid() {
+		return false
+	}
+	if scenario.CostModel != nil && (*scenario.CostModel < 0 || *scenario.CostModel >= len(CostModelMappings)) {
+		return false
+	}
+	if scenario.Initial != nil && (*scenario.Initial < 0 || *scenario.Initial >= len(InitialConditionsMappings)) {
+		return false
+	}
+	if scenario.Fulfilment != nil && (*scenario.Fulfilment < 0 || *scenario.Fulfilment >= len(FulfilmentMappings)) {
+		return false
+	}
+	return true
+}
+
+// apply changes the settings of a game in the lobby. The scenario must be
+// valid.
+func (scenario Scenario) apply(game *Game) {
+	if scenario.LastWeek != nil {
+		game.LastWeek = *scenario.LastWeek
+	}
+	if scenario.Seed != nil {
+		game.Seed = *scenario.Seed
+	}
+	if scenario.Demand != nil {
+		game.Demand = *scenario.Demand
+	}
+	if scenario.CostModel != nil {
+		game.SetCostModel(*scenario.CostModel)
+	}
+	if scenario.Initial != nil {
+		game.SetInitialConditions(*scenario.Initial)
+	}
+	if scenario.Fulfilment != nil {
+		game.SetFulfilment(*scenario.Fulfilment)
+	}
+}
+
+// StartProblem explains why the game cannot start, or returns "".
+func (game *Game) StartProblem() string {
+	if game.State != LOBBY {
+		return "the game has already started"
+	}
+
+	problems := []string{}
+	players := make([]int, len(game.Stages)+1)
+	for _, playerState := range game.PlayerState {
+		if !game.ValidRole(playerState.Role) {
+			name := DisplayPlayer(playerState).Name
+			if name == "" {
+				name = playerState.PlayerID
+			}
+			problems = append(problems, name+" has no role")
+			continue
+		}
+		players[playerState.Role]++
+	}
+	for role := 1; role < len(players); role++ {
+		switch {
+		case players[role] == 0:
+			problems = append(problems, "nobody is playing the "+game.Stage(role).Name)
+		case players[role] > 1:
+			problems = append(problems, "more than one player is the "+game.Stage(role).Name)
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+type StartResult struct {
+	GameID  string `json:"gameId"`
+	Started bool   `json:"started"`
+	Reason  string `json:"reason"`
+}
+
+// StartAll applies the scenario to every game of the session that is ready
+// and starts them together. All the games are locked, in order of id, while
+// they are checked and started, so every team starts on the same week with
+// the same settings. Games that are not ready are left untouched.
+func (session *Session) StartAll(scenario Scenario) []StartResult {
+	if scenario.Seed == nil {
+		seed := NewSeed()
+		scenario.Seed = &seed
+	}
+
+	ids := append([]string{}, session.GameIDs...)
+	sort.Strings(ids)
+	games := []*Game{}
+	results := []StartResult{}
+	for _, id := range ids {
+		if game := FindGame(id); game != nil {
+			games = append(games, game)
+		} else {
+			results = append(results, StartResult{GameID: id, Reason: "the game no longer exists"})
+		}
+	}
+
+	for _, game := range games {
+		game.lock.Lock()
+	}
+	started := []*Game{}
+	for _, game := range games {
+		result := StartResult{GameID: game.ID, Reason: game.StartProblem()}
+		if result.Reason == "" {
+			scenario.apply(game)
+			result.Started = game.Start() == nil
+			started = append(started, game)
+		}
+		results = append(results, result)
+	}
+	for _, game := range started {
+		game.Save()
+	}
+	for _, game := range games {
+		game.lock.Unlock()
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].GameID < results[j].GameID
+	})
+
+	for _, game := range started {
+		Subscriptions.publish(GameTopic(game.ID))
+	}
+	if len(started) > 0 {
+		Subscriptions.publish(SessionTopic(session.ID))
+	}
+	return results
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/websocket"
@@ -26,11 +31,13 @@ type Player struct {
 }
 
 var Players = map[string]*Player{}
+var playersLock sync.Mutex
 
 const (
 	LOBBY = iota
 	PLAYING
 	FINISHED
+	PAUSED
 )
 
 var GameStateMappings = []NameValueMapping{
@@ -46,6 +53,10 @@ var GameStateMappings = []NameValueMapping{
 		Name:  "finished",
 		Value: FINISHED,
 	},
+	NameValueMapping{
+		Name:  "paused",
+		Value: PAUSED,
+	},
 }
 
 const (
@@ -79,65 +90,228 @@ var GameRoleMappings = []NameValueMapping{
 	},
 }
 
+// MARKET is the customer key used for end-customer demand in CustomerBacklog.
+const MARKET = 0
+
+// MAX_ORDER is the largest order a stage may place in one week.
+const MAX_ORDER = 10000
+
+// MAX_WEEKS is the longest a game may last. Every week is stepped, recorded
+// and snapshotted while holding the game's lock, and bots play a whole game
+// at once.
+const MAX_WEEKS = 250
+
+func ValidLastWeek(lastWeek int) bool {
+	return lastWeek >= 1 && lastWeek <= MAX_WEEKS
+}
+
 type PlayerState struct {
-	PlayerID      string `json:"playerId"`
-	Role          int    `json:"role"`
-	Incoming      int    `json:"incoming"`
-	Outgoing      int    `json:"outgoing"`
-	Outstanding   int    `json:"outstanding"`
-	LastSent      int    `json:"lastsent"`
-	Stock         int    `json:"stock"`
-	Backlog       int    `json:"backlog"`
-	Pending0      int    `json:"pending0"`
-	Pending1      int    `json:"pending1"`
-	Costs         int    `json:"costs"`
-	OutgoingPrev  []int  `json:"outgoingprev"`
-	StockBackPrev []int  `json:"stockbackprev"`
-	CostPrev      []int  `json:"costprev"`
+	PlayerID        string       `json:"playerId"`
+	Role            int          `json:"role"`
+	Incoming        int          `json:"incoming"`
+	Outgoing        int          `json:"outgoing"`
+	Ready           bool         `json:"ready"`
+	Outstanding     int          `json:"outstanding"`
+	LastSent        int          `json:"lastsent"`
+	Stock           int          `json:"stock"`
+	Backlog         int          `json:"backlog"`
+	CustomerBacklog map[int]int  `json:"customerbacklog"`
+	Shipments       Pipeline     `json:"shipments"`
+	Orders          Pipeline     `json:"orders"`
+	Costs           Money        `json:"costs"`
+	OutgoingPrev    []int        `json:"outgoingprev"`
+	StockBackPrev   []int        `json:"stockbackprev"`
+	CostPrev        []Money      `json:"costprev"`
+	LostSales       []int        `json:"lostsales"`
+	History         []WeekRecord `json:"history"`
+	Bot             *Bot         `json:"bot,omitempty"`
+	CoManagers      []string     `json:"coManagers,omitempty"`
+
+	game *Game
 }
 
 type Game struct {
-	ID          string         `json:"id"`
-	State       int            `json:"state"`
-	PlayerState []*PlayerState `json:"playerState"`
-	Week        int            `json:"week"`
-	LastWeek    int            `json:"lastweek"`
+	ID          string            `json:"id"`
+	HostID      string            `json:"hostId"`
+	State       int               `json:"state"`
+	PlayerState []*PlayerState    `json:"playerState"`
+	Stages      []Stage           `json:"stages"`
+	Week        int               `json:"week"`
+	LastWeek    int               `json:"lastweek"`
+	Demand      DemandConfig      `json:"demand"`
+	Seed        int64             `json:"seed"`
+	Costs       CostModel         `json:"costModel"`
+	Fulfilment  int               `json:"fulfilment"`
+	Initial     InitialConditions `json:"initial"`
+	SessionID   string            `json:"sessionId"`
+	Snapshots   []WeekSnapshot    `json:"snapshots"`
+
+	Seats        int           `json:"seats"`
+	SwapRequests []SwapRequest `json:"swapRequests"`
+
+	TurnLimit          int       `json:"turnLimit"`
+	DefaultOrderPolicy int       `json:"defaultOrder"`
+	Deadline           time.Time `json:"deadline"`
+
+	// Debrief holds the analytics worked out when the game finished.
+	Debrief *Analytics `json:"analytics,omitempty"`
+
+	lock      sync.Mutex
+	timer     *time.Timer
+	timerGen  int
+	benchmark bool
 }
 
 var Games = map[string]*Game{}
+var gamesLock sync.Mutex
 
 func FindGame(id string) *Game {
+	gamesLock.Lock()
+	defer gamesLock.Unlock()
 	game, _ := Games[id]
 	return game
 }
 
 func ExistsGame(id string) bool {
+	gamesLock.Lock()
+	defer gamesLock.Unlock()
 	_, found := Games[id]
 	return found
 }
 
-func FindOrCreateGame(id string) *Game {
+// FindOrCreateGame returns the game, creating it with hostID as its host if
+// it does not exist yet. Only mutations that join or create a game use it.
+func FindOrCreateGame(id string, hostID string) *Game {
+	gamesLock.Lock()
+	defer gamesLock.Unlock()
 	game, found := Games[id]
 	if !found {
 		newGame := &Game{
 			ID:          id,
+			HostID:      hostID,
 			State:       LOBBY,
 			PlayerState: []*PlayerState{},
+			Stages:      LinearStages(4),
 			Week:        0,
 			LastWeek:    50,
+			Demand:      DefaultDemandConfig(),
+			Seed:        NewSeed(),
+			Costs:       DefaultCostModel(),
+			Initial:     DefaultInitialConditions(),
+			Seats:       1,
 		}
 		Games[id] = newGame
+		newGame.Save()
 		return newGame
 	}
 	return game
 }
 
+var seedSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// NewSeed picks a seed that still fits in a GraphQL Int.
+func NewSeed() int64 {
+	return seedSource.Int63n(math.MaxInt32)
+}
+
+// WeekRand returns the random source for a given week. It depends only on the
+// seed and the week so a game can be replayed or resumed at any point.
+func (game *Game) WeekRand(week int) *rand.Rand {
+	return rand.New(rand.NewSource(game.Seed*1000003 + int64(week)))
+}
+
+// Update applies a change to the game while holding its lock. If the change
+// reports that it modified the game, the game is saved and subscribers
+// of this game are notified once the lock has been released.
+func (game *Game) Update(update func() bool) bool {
+	game.lock.Lock()
+	changed := update()
+	if changed {
+		game.Save()
+	}
+	sessionID := game.SessionID
+	game.lock.Unlock()
+
+	if changed {
+		Subscriptions.publish(GameTopic(game.ID))
+		if sessionID != "" {
+			Subscriptions.publish(SessionTopic(sessionID))
+		}
+	}
+	return changed
+}
+
+// Apply is Update for changes that explain why they could not be made.
+func (game *Game) Apply(change func() error) error {
+	var err error
+	game.Update(func() bool {
+		err = change()
+		return err == nil
+	})
+	return err
+}
+
+// Snapshot returns a deep copy of the game that can be read without holding
+// its lock, e.g. while resolving the fields of a query. The copy's week
+// snapshots keep only their week, since reads never need the saved stages.
+func (game *Game) Snapshot() *Game {
+	game.lock.Lock()
+	snapshots := game.Snapshots
+	weeks := make([]WeekSnapshot, len(snapshots))
+	for index, snapshot := range snapshots {
+		weeks[index].Week = snapshot.Week
+	}
+	game.Snapshots = weeks
+	data, err := json.Marshal(game)
+	game.Snapshots = snapshots
+	game.lock.Unlock()
+	if err != nil {
+		panic(err)
+	}
+
+	snapshot := &Game{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		panic(err)
+	}
+	for _, playerState := range snapshot.PlayerState {
+		playerState.game = snapshot
+	}
+	return snapshot
+}
+
+// FindPlayer returns a copy of the player, safe to read after the call.
 func FindPlayer(id string) *Player {
-	player, _ := Players[id]
-	return player
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	player, found := Players[id]
+	if !found {
+		return nil
+	}
+	copy := *player
+	return &copy
+}
+
+// CreatePlayer adds a new player, returning nil if the id is already taken
+// or reserved for bots.
+func CreatePlayer(id string, name string) *Player {
+	playersLock.Lock()
+	defer playersLock.Unlock()
+	if _, found := Players[id]; found || IsBotID(id) {
+		return nil
+	}
+	player := &Player{
+		ID:   id,
+		Name: name,
+	}
+	Players[id] = player
+	player.Save()
+	copy := *player
+	return &copy
 }
 
 func FindOrCreatePlayer(id string, name string) *Player {
+	playersLock.Lock()
+	defer playersLock.Unlock()
 	player, found := Players[id]
 	if !found {
 		newPlayer := &Player{
@@ -145,166 +319,273 @@ func FindOrCreatePlayer(id string, name string) *Player {
 			Name: name,
 		}
 		Players[id] = newPlayer
+		newPlayer.Save()
 		return newPlayer
 	}
 	player.Name = name
+	player.Save()
 	return player
 }
 
-func (game *Game) AddPlayer(id string) bool {
+func (game *Game) AddPlayer(id string) error {
 	if game.State != LOBBY {
-		return false
+		return errNotInLobby()
 	}
-	for _, value := range game.PlayerState {
-		if value.PlayerID == id {
-			return false
+	if game.FindPlayerState(id) != nil {
+		return NewGameError(ERROR_ALREADY_IN_GAME, "%s is already in the game", id)
+	}
+	game.PlayerState = append(game.PlayerState, newPlayerState(id))
+	return nil
+}
+
+func newPlayerState(id string) *PlayerState {
+	return &PlayerState{
+		PlayerID:        id,
+		Incoming:        0,
+		Outgoing:        -1,
+		Outstanding:     0,
+		LastSent:        0,
+		Stock:           15,
+		Backlog:         0,
+		CustomerBacklog: map[int]int{},
+		Shipments:       Pipeline{},
+		Orders:          Pipeline{},
+		Costs:           0,
+		OutgoingPrev:    []int{},
+		StockBackPrev:   []int{},
+		CostPrev:        []Money{},
+		LostSales:       []int{},
+		History:         []WeekRecord{},
+	}
+}
+
+// RemovePlayer takes a player out of the game. Once the game has started
+// their stage stays in play, run by someone else.
+func (game *Game) RemovePlayer(id string) error {
+	if game.State == FINISHED {
+		return NewGameError(ERROR_GAME_FINISHED, "the game is over")
+	}
+	playerState := game.FindPlayerState(id)
+	if playerState == nil {
+		return NewGameError(ERROR_NOT_IN_GAME, "%s is not in the game", id)
+	}
+	if game.State == LOBBY {
+		own := game.unseat(id)
+		for index, playerState := range game.PlayerState {
+			if playerState == own {
+				game.PlayerState = append(game.PlayerState[:index], game.PlayerState[index+1:]...)
+				break
+			}
+		}
+	} else {
+		if playerState.Bot != nil {
+			return NewGameError(ERROR_BOT, "bots cannot leave a game that has started")
 		}
+		game.vacate(playerState, id)
 	}
-	newPlayerState := &PlayerState{
-		PlayerID:      id,
-		Incoming:      0,
-		Outgoing:      -1,
-		Outstanding:   0,
-		LastSent:      0,
-		Stock:         15,
-		Backlog:       0,
-		Pending0:      0,
-		Pending1:      0,
-		Costs:         0,
-		OutgoingPrev:  []int{},
-		StockBackPrev: []int{},
-		CostPrev:      []int{},
-	}
-	game.PlayerState = append(game.PlayerState, newPlayerState)
-	return true
+	if game.HostID == id {
+		game.HostID = game.nextHost()
+	}
+	return nil
 }
 
-func (game *Game) RemovePlayer(id string) bool {
-	for index, playerState := range game.PlayerState {
-		if playerState.PlayerID == id {
-			game.PlayerState = append(game.PlayerState[:index], game.PlayerState[index+1:]...)
-			return true
+// nextHost returns the first human player left in the game, or "" if there
+// are none.
+func (game *Game) nextHost() string {
+	for _, playerState := range game.PlayerState {
+		if playerState.Bot == nil {
+			return playerState.PlayerID
 		}
 	}
-	return false
+	return ""
 }
 
+// FindPlayerState returns the stage the player holds or co-manages.
 func (game *Game) FindPlayerState(id string) *PlayerState {
 	for _, playerState := range game.PlayerState {
-		if playerState.PlayerID == id {
+		if playerState.Seated(id) {
 			return playerState
 		}
 	}
 	return nil
 }
 
-func (game *Game) Start() bool {
-	if game.State == LOBBY {
-		var p1 *PlayerState = nil
-		var p2 *PlayerState = nil
-		var p3 *PlayerState = nil
-		var p4 *PlayerState = nil
-
-		for _, playerState := range game.PlayerState {
-			if playerState.Role == RETAILER {
-				p1 = playerState
-			}
-			if playerState.Role == WHOLESALER {
-				p2 = playerState
-			}
-			if playerState.Role == DISTRIBUTER {
-				p3 = playerState
-			}
-			if playerState.Role == MANUFACTURER {
-				p4 = playerState
-			}
-		}
-
-		if p1 == nil || p2 == nil || p3 == nil || p4 == nil || len(game.PlayerState) != 4 {
-			return false
-		}
-
-		game.State = PLAYING
+// orderingPlayer returns the stage of a player who may still change this
+// week's order.
+func (game *Game) orderingPlayer(playerID string) (*PlayerState, error) {
+	if game.State != PLAYING {
+		return nil, errNotPlaying()
+	}
+	playerState := game.FindPlayerState(playerID)
+	if playerState == nil {
+		return nil, NewGameError(ERROR_NOT_IN_GAME, "%s is not in the game", playerID)
+	}
+	if playerState.Bot != nil {
+		return nil, NewGameError(ERROR_BOT, "bots place their own orders")
+	}
+	if playerState.Ready {
+		return nil, NewGameError(ERROR_ORDER_LOCKED, "the order is already locked in")
+	}
+	return playerState, nil
+}
 
+// CanViewPrivateState reports whether viewer may see the stock, backlog and
+// costs of the given player.
+func (game *Game) CanViewPrivateState(viewerID string, playerID string) bool {
+	if viewerID == "" {
+		return false
+	}
+	if viewerID == playerID || game.IsHost(viewerID) {
 		return true
 	}
-	return false
+	playerState := game.FindPlayerState(playerID)
+	return playerState != nil && playerState.Seated(viewerID)
+}
+
+func (game *Game) Start() error {
+	if game.State != LOBBY {
+		return errNotInLobby()
+	}
+	stages, complete := game.StagePlayers()
+	if !complete {
+		return NewGameError(ERROR_ROLES_INCOMPLETE, "%s", game.StartProblem())
+	}
+
+	game.applyInitialConditions(stages)
+	game.SwapRequests = []SwapRequest{}
+	game.Snapshots = []WeekSnapshot{}
+	game.recordSnapshot()
+	game.State = PLAYING
+	game.TryStep()
+	game.scheduleTurn()
+	return nil
 }
 
+// TryStep advances through every week in which all stages have ordered, and
+// reports whether it advanced at all. Bots order as each week opens.
 func (game *Game) TryStep() bool {
+	stepped := false
+	for game.step() {
+		stepped = true
+	}
+	if stepped {
+		game.scheduleTurn()
+	}
+	return stepped
+}
+
+func (game *Game) step() bool {
 	if game.State != PLAYING {
 		return false
 	}
+	game.PlayBots()
 
-	var p1 *PlayerState = nil
-	var p2 *PlayerState = nil
-	var p3 *PlayerState = nil
-	var p4 *PlayerState = nil
-
+	stages, complete := game.StagePlayers()
+	if !complete {
+		return false
+	}
 	for _, playerState := range game.PlayerState {
-		if playerState.Outgoing == -1 {
+		if !playerState.Ready {
 			return false
 		}
-		if playerState.Role == RETAILER {
-			p1 = playerState
-		}
-		if playerState.Role == WHOLESALER {
-			p2 = playerState
+	}
+
+	// Orders travel upstream through each stage's order pipeline. Stages
+	// nobody orders from see customer demand, recorded as owed to the MARKET.
+	// Production stages put the orders reaching them into their own
+	// shipment pipeline.
+	records := make([]WeekRecord, len(stages))
+	for role := 1; role < len(stages); role++ {
+		records[role] = openWeekRecord(game.Week, stages[role])
+	}
+
+	rng := game.WeekRand(game.Week)
+	demand := game.Demand.Model()
+	for _, p := range game.PlayerState {
+		p.Incoming = 0
+	}
+	production := make([]int, len(stages))
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		if p.CustomerBacklog == nil {
+			p.CustomerBacklog = map[int]int{}
 		}
-		if playerState.Role == DISTRIBUTER {
-			p3 = playerState
+		if game.SellsToMarket(role) {
+			p.Incoming = demand.Demand(game.Week, rng)
+			p.CustomerBacklog[MARKET] += p.Incoming
 		}
-		if playerState.Role == MANUFACTURER {
-			p4 = playerState
+
+		order := p.Orders.Advance(p.Outgoing)
+		if supplier := game.Stage(role).Supplier; supplier != NONE {
+			stages[supplier].Incoming += order
+			if stages[supplier].CustomerBacklog == nil {
+				stages[supplier].CustomerBacklog = map[int]int{}
+			}
+			stages[supplier].CustomerBacklog[role] += order
+		} else {
+			production[role] = order
 		}
 	}
 
-	if p1 == nil || p2 == nil || p3 == nil || p4 == nil || len(game.PlayerState) != 4 {
-		return false
-	}
+	shipments := make([]map[int]int, len(stages))
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		received := p.Shipments.Next()
+		p.Backlog = p.Backlog + p.Incoming
+		p.Outstanding = p.Outstanding + p.Outgoing - received
+		p.Stock = p.Stock + received
+
+		shipments[role] = Allocate(p.Stock, p.CustomerBacklog)
+		p.LastSent = 0
+		for customer, amount := range shipments[role] {
+			p.CustomerBacklog[customer] -= amount
+			p.LastSent += amount
+		}
+		p.Stock = p.Stock - p.LastSent
+		p.Backlog = p.Backlog - p.LastSent
 
-	p1.Incoming = rand.Intn(20) // Customers
-	p2.Incoming = p1.Outgoing
-	p3.Incoming = p2.Outgoing
-	p4.Incoming = p3.Outgoing
+		lost := 0
+		if game.LosesSales(role) {
+			lost = game.loseSales(p, stages)
+		}
+		p.LostSales = append(p.LostSales, lost)
+		p.Costs = p.Costs + game.Costs.Rates(role).Cost(p.Stock, p.Backlog, lost, p.Outgoing)
 
-	for _, p := range game.PlayerState {
-		p.Backlog = p.Backlog + p.Incoming
-		p.Outstanding = p.Outstanding + p.Outgoing - p.Pending0
-		p.Stock = p.Stock + p.Pending0
-		p.Pending0 = p.Pending1
-
-		if p.Stock > p.Backlog {
-			p.LastSent = p.Backlog
-			p.Stock = p.Stock - p.Backlog
-			p.Backlog = 0
+		records[role].Received = received
+		records[role].Sent = p.LastSent
+		records[role].Lost = lost
+	}
+
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		if supplier := game.Stage(role).Supplier; supplier != NONE {
+			p.Shipments.Advance(shipments[supplier][role])
 		} else {
-			p.LastSent = p.Stock
-			p.Backlog = p.Backlog - p.Stock
-			p.Stock = 0
+			p.Shipments.Advance(production[role])
 		}
-		p.Costs = p.Costs + p.Stock + p.Backlog*2
 	}
 
-	p1.Pending1 = p2.LastSent
-	p2.Pending1 = p3.LastSent
-	p3.Pending1 = p4.LastSent
-	p4.Pending1 = p4.Outgoing
+	for role := 1; role < len(stages); role++ {
+		records[role].close(stages[role])
+		stages[role].History = append(stages[role].History, records[role])
+	}
 
 	for _, p := range game.PlayerState {
 		p.OutgoingPrev = append(p.OutgoingPrev, p.Outgoing)
 		p.StockBackPrev = append(p.StockBackPrev, p.Stock-p.Backlog)
 		p.CostPrev = append(p.CostPrev, p.Costs)
 		p.Outgoing = -1
+		p.Ready = false
 	}
 
 	if game.Week >= game.LastWeek-1 {
-		game.State = FINISHED
+		game.finish()
 	} else {
 		game.Week = game.Week + 1
+		game.recordSnapshot()
 	}
 
-	return false
+	return true
 }
 
 var nameValueType = graphql.NewObject(graphql.ObjectConfig{
@@ -319,6 +600,65 @@ var nameValueType = graphql.NewObject(graphql.ObjectConfig{
 	},
 })
 
+var gameStateEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name:   "GameState",
+	Values: enumValues(GameStateMappings),
+})
+
+// roleEnum names roles by their position in the chain: STAGE_1 is the first
+// stage of Game.Stages. The names stay neutral since chains differ in length
+// and shape; the stage field gives the name the host chose.
+var roleEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name:   "Role",
+	Values: roleEnumValues(),
+})
+
+func enumValues(mappings []NameValueMapping) graphql.EnumValueConfigMap {
+	values := graphql.EnumValueConfigMap{}
+	for _, mapping := range mappings {
+		values[strings.ToUpper(mapping.Name)] = &graphql.EnumValueConfig{Value: mapping.Value}
+	}
+	return values
+}
+
+func roleEnumValues() graphql.EnumValueConfigMap {
+	values := graphql.EnumValueConfigMap{
+		"NONE": &graphql.EnumValueConfig{Value: NONE},
+	}
+	for role := 1; role <= MAX_STAGES; role++ {
+		values[fmt.Sprintf("STAGE_%d", role)] = &graphql.EnumValueConfig{Value: role}
+	}
+	return values
+}
+
+// roleFromArgs reads the position argument, falling back on the legacy role
+// argument. It reports false if neither was given.
+func roleFromArgs(args map[string]interface{}) (int, bool) {
+	if role, found := args["position"].(int); found {
+		return role, true
+	}
+	role, found := args["role"].(int)
+	return role, found
+}
+
+var swapRequestType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SwapRequest",
+	Fields: graphql.Fields{
+		"from": &graphql.Field{
+			Type: playerType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return FindPlayer(p.Source.(SwapRequest).From), nil
+			},
+		},
+		"to": &graphql.Field{
+			Type: playerType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return FindPlayer(p.Source.(SwapRequest).To), nil
+			},
+		},
+	},
+})
+
 var playerType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Player",
 	Fields: graphql.Fields{
@@ -331,43 +671,94 @@ var playerType = graphql.NewObject(graphql.ObjectConfig{
 	},
 })
 
-var publicPlayerStateType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "PublicPlayerState",
+var weekRecordType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "WeekRecord",
 	Fields: graphql.Fields{
-		"player": &graphql.Field{
-			Type: playerType,
+		"week": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"incoming": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"ordered": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"received": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"sent": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"lost": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"cost": &graphql.Field{
+			Type: graphql.Float,
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerState := p.Source.(*PlayerState)
-				return FindPlayer(playerState.PlayerID), nil
+				return p.Source.(WeekRecord).Cost.Float(), nil
 			},
 		},
-		"outgoing": &graphql.Field{
+		"stockBefore": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"role": &graphql.Field{
-			Type: nameValueType,
+		"backlogBefore": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"outstandingBefore": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"costsBefore": &graphql.Field{
+			Type: graphql.Float,
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerState := p.Source.(*PlayerState)
-				return GameRoleMappings[playerState.Role], nil
+				return p.Source.(WeekRecord).CostsBefore.Float(), nil
+			},
+		},
+		"stockAfter": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"backlogAfter": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"outstandingAfter": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"costsAfter": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(WeekRecord).CostsAfter.Float(), nil
 			},
 		},
 	},
 })
 
-var privatePlayerStateType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "PrivatePlayerState",
+var exportRowType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ExportRow",
 	Fields: graphql.Fields{
+		"week": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"role": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"stage": &graphql.Field{
+			Type: graphql.String,
+		},
 		"player": &graphql.Field{
-			Type: playerType,
-			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerState := p.Source.(*PlayerState)
-				return FindPlayer(playerState.PlayerID), nil
-			},
+			Type: graphql.String,
 		},
-		"incoming": &graphql.Field{
+		"demand": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"outgoing": &graphql.Field{
+		"ordered": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"received": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"sent": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"lost": &graphql.Field{
 			Type: graphql.Int,
 		},
 		"stock": &graphql.Field{
@@ -376,174 +767,1757 @@ var privatePlayerStateType = graphql.NewObject(graphql.ObjectConfig{
 		"backlog": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"lastsent": &graphql.Field{
+		"outstanding": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"pending0": &graphql.Field{
+		"cost": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"totalCost": &graphql.Field{
+			Type: graphql.Float,
+		},
+	},
+})
+
+var roleAnalyticsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RoleAnalytics",
+	Fields: graphql.Fields{
+		"role": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"costs": &graphql.Field{
+		"stage": &graphql.Field{
+			Type: graphql.String,
+		},
+		"demandVariance": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"orderVariance": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amplification": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Order variance over the variance of the customer demand the stage serves, or null if demand never varied.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				amplification, valid := p.Source.(RoleAnalytics).Amplification()
+				if !valid {
+					return nil, nil
+				}
+				return amplification, nil
+			},
+		},
+		"peakBacklog": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"outstanding": &graphql.Field{
+		"peakBacklogWeek": &graphql.Field{
 			Type: graphql.Int,
 		},
-		"outgoingprev": &graphql.Field{
-			Type: graphql.NewList(graphql.Int),
+		"cost": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleAnalytics).Cost.Float(), nil
+			},
 		},
-		"stockbackprev": &graphql.Field{
-			Type: graphql.NewList(graphql.Int),
+		"benchmarkCost": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleAnalytics).BenchmarkCost.Float(), nil
+			},
 		},
-		"costprev": &graphql.Field{
-			Type: graphql.NewList(graphql.Int),
+	},
+})
+
+var analyticsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Analytics",
+	Fields: graphql.Fields{
+		"weeks": &graphql.Field{
+			Type: graphql.Int,
 		},
-		"role": &graphql.Field{
-			Type: nameValueType,
+		"totalCost": &graphql.Field{
+			Type: graphql.Float,
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerState := p.Source.(*PlayerState)
-				return GameRoleMappings[playerState.Role], nil
+				return p.Source.(*Analytics).TotalCost.Float(), nil
+			},
+		},
+		"benchmarkCost": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*Analytics).BenchmarkCost.Float(), nil
+			},
+		},
+		"roles": &graphql.Field{
+			Type: graphql.NewList(roleAnalyticsType),
+		},
+	},
+})
+
+var teamType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Team",
+	Fields: graphql.Fields{
+		"rank": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The team's place on the leaderboard.",
+		},
+		"game": &graphql.Field{
+			Type: gameType,
+		},
+		"week": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"state": &graphql.Field{
+			Type:              nameValueType,
+			DeprecationReason: "Use status.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				team := p.Source.(Team)
+				return GameStateMappings[team.State], nil
+			},
+		},
+		"status": &graphql.Field{
+			Type: graphql.NewNonNull(gameStateEnum),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(Team).State, nil
+			},
+		},
+		"cost": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "The cumulative cost of every stage in the team's game.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				team := p.Source.(Team)
+				return team.Cost.Float(), nil
+			},
+		},
+	},
+})
+
+var sessionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Session",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"facilitator": &graphql.Field{
+			Type: playerType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				session := p.Source.(*Session)
+				return FindPlayer(session.FacilitatorID), nil
+			},
+		},
+		"teams": &graphql.Field{
+			Type:        graphql.NewList(teamType),
+			Description: "Facilitator only. Every team's progress, in the order they were added.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				session := p.Source.(*Session)
+				if !session.IsFacilitator(ActingPlayer(p.Context)) {
+					return nil, nil
+				}
+				return session.Teams(), nil
+			},
+		},
+		"leaderboard": &graphql.Field{
+			Type:        graphql.NewList(teamType),
+			Description: "Finished teams ranked by cost, lowest first.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				session := p.Source.(*Session)
+				return session.Leaderboard(), nil
+			},
+		},
+	},
+})
+
+var publicPlayerStateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PublicPlayerState",
+	Fields: graphql.Fields{
+		"player": &graphql.Field{
+			Type: playerType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return DisplayPlayer(playerState), nil
+			},
+		},
+		"coManagers": &graphql.Field{
+			Type:        graphql.NewList(playerType),
+			Description: "The other players running this stage, if the game has more than one seat per role.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				players := []*Player{}
+				for _, id := range p.Source.(*PlayerState).CoManagers {
+					if player := FindPlayer(id); player != nil {
+						players = append(players, player)
+					}
+				}
+				return players, nil
+			},
+		},
+		"ready": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Whether the player has locked in their order for this week.",
+		},
+		"bot": &graphql.Field{
+			Type:        nameValueType,
+			Description: "The strategy of a bot, or null for human players.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				if playerState.Bot == nil {
+					return nil, nil
+				}
+				return StrategyMappings[playerState.Bot.Strategy], nil
+			},
+		},
+		"role": &graphql.Field{
+			Type:              nameValueType,
+			DeprecationReason: "Use position, and stage for the name.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.game.RoleMapping(playerState.Role), nil
+			},
+		},
+		"position": &graphql.Field{
+			Type: graphql.NewNonNull(roleEnum),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.game.RoleMapping(playerState.Role).Value, nil
+			},
+		},
+		"stage": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The name of the stage the player runs, if they have a role.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				if !playerState.game.ValidRole(playerState.Role) {
+					return nil, nil
+				}
+				return playerState.game.Stage(playerState.Role).Name, nil
+			},
+		},
+	},
+})
+
+var privatePlayerStateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PrivatePlayerState",
+	Fields: graphql.Fields{
+		"player": &graphql.Field{
+			Type: playerType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return FindPlayer(playerState.PlayerID), nil
+			},
+		},
+		"incoming": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"outgoing": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The order for this week, or -1 if none has been submitted.",
+		},
+		"ready": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"stock": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"backlog": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"lastsent": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"pending0": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The shipment arriving next week.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.Shipments.Next(), nil
+			},
+		},
+		"shipments": &graphql.Field{
+			Type:        graphql.NewList(graphql.Int),
+			Description: "Shipments in transit to this stage, arriving soonest first.",
+		},
+		"orders": &graphql.Field{
+			Type:        graphql.NewList(graphql.Int),
+			Description: "Orders in transit to the supplier, arriving soonest first.",
+		},
+		"costs": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.Costs.Float(), nil
+			},
+		},
+		"outstanding": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"outgoingprev": &graphql.Field{
+			Type: graphql.NewList(graphql.Int),
+		},
+		"stockbackprev": &graphql.Field{
+			Type: graphql.NewList(graphql.Int),
+		},
+		"history": &graphql.Field{
+			Type:        graphql.NewList(weekRecordType),
+			Description: "The stage's ledger, optionally limited to weeks from to to inclusive.",
+			Args: graphql.FieldConfigArgument{
+				"from": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"to": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				from, validFrom := p.Args["from"].(int)
+				if !validFrom {
+					from = -1
+				}
+				to, validTo := p.Args["to"].(int)
+				if !validTo {
+					to = -1
+				}
+				return playerState.HistoryRange(from, to), nil
+			},
+		},
+		"lostsales": &graphql.Field{
+			Type:        graphql.NewList(graphql.Int),
+			Description: "Units of unmet demand discarded each week under a lost sales policy.",
+		},
+		"costprev": &graphql.Field{
+			Type: graphql.NewList(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				costs := []float64{}
+				for _, cost := range playerState.CostPrev {
+					costs = append(costs, cost.Float())
+				}
+				return costs, nil
+			},
+		},
+		"role": &graphql.Field{
+			Type:              nameValueType,
+			DeprecationReason: "Use position, and stage for the name.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.game.RoleMapping(playerState.Role), nil
+			},
+		},
+		"position": &graphql.Field{
+			Type: graphql.NewNonNull(roleEnum),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				return playerState.game.RoleMapping(playerState.Role).Value, nil
+			},
+		},
+		"stage": &graphql.Field{
+			Type:        graphql.String,
+			Description: "The name of the stage the player runs, if they have a role.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerState := p.Source.(*PlayerState)
+				if !playerState.game.ValidRole(playerState.Role) {
+					return nil, nil
+				}
+				return playerState.game.Stage(playerState.Role).Name, nil
+			},
+		},
+	},
+})
+
+// costRatesType resolves from RoleCostRates; role is 0 for the default rates.
+var costRatesType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CostRates",
+	Fields: graphql.Fields{
+		"role": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"holding": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleCostRates).Rates.Holding.Float(), nil
+			},
+		},
+		"backlog": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleCostRates).Rates.Backlog.Float(), nil
+			},
+		},
+		"order": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleCostRates).Rates.Order.Float(), nil
+			},
+		},
+		"lostSale": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleCostRates).Rates.LostSale.Float(), nil
+			},
+		},
+		"fixedOrder": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleCostRates).Rates.FixedOrder.Float(), nil
+			},
+		},
+	},
+})
+
+var costModelType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CostModel",
+	Fields: graphql.Fields{
+		"default": &graphql.Field{
+			Type: costRatesType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				model := p.Source.(CostModel)
+				return RoleCostRates{Role: NONE, Rates: model.Default}, nil
+			},
+		},
+		"roles": &graphql.Field{
+			Type:        graphql.NewList(costRatesType),
+			Description: "Roles whose rates differ from the default.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				model := p.Source.(CostModel)
+				return model.RoleRates(), nil
+			},
+		},
+	},
+})
+
+// stageConditionsType resolves from RoleStageConditions; role is 0 for the
+// default conditions.
+var stageConditionsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "StageConditions",
+	Fields: graphql.Fields{
+		"role": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"stock": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleStageConditions).Conditions.Stock, nil
+			},
+		},
+		"backlog": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleStageConditions).Conditions.Backlog, nil
+			},
+		},
+		"shipment": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleStageConditions).Conditions.Shipment, nil
+			},
+		},
+		"order": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(RoleStageConditions).Conditions.Order, nil
+			},
+		},
+	},
+})
+
+var initialConditionsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "InitialConditions",
+	Fields: graphql.Fields{
+		"default": &graphql.Field{
+			Type: stageConditionsType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				initial := p.Source.(InitialConditions)
+				return RoleStageConditions{Role: NONE, Conditions: initial.Default}, nil
+			},
+		},
+		"roles": &graphql.Field{
+			Type:        graphql.NewList(stageConditionsType),
+			Description: "Roles whose conditions differ from the default.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				initial := p.Source.(InitialConditions)
+				return initial.RoleConditions(), nil
+			},
+		},
+	},
+})
+
+// demandConfigFromArgs reads the arguments of submitDemandModel, or the
+// fields of a DemandInput.
+func demandConfigFromArgs(args map[string]interface{}) DemandConfig {
+	demand := DemandConfig{}
+	demand.Kind, _ = args["model"].(int)
+	demand.Base, _ = args["base"].(int)
+	demand.Step, _ = args["step"].(int)
+	demand.StepWeek, _ = args["stepWeek"].(int)
+	demand.Min, _ = args["min"].(int)
+	demand.Max, _ = args["max"].(int)
+	demand.Mean, _ = args["mean"].(float64)
+	demand.StdDev, _ = args["stdDev"].(float64)
+	demand.Amplitude, _ = args["amplitude"].(float64)
+	demand.Period, _ = args["period"].(int)
+	series, _ := args["series"].([]interface{})
+	for _, value := range series {
+		week, _ := value.(int)
+		demand.Series = append(demand.Series, week)
+	}
+	return demand
+}
+
+var demandInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "DemandInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"model": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.Int),
+		},
+		"base": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"step": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"stepWeek": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"min": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"max": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"mean": &graphql.InputObjectFieldConfig{
+			Type: graphql.Float,
+		},
+		"stdDev": &graphql.InputObjectFieldConfig{
+			Type: graphql.Float,
+		},
+		"amplitude": &graphql.InputObjectFieldConfig{
+			Type: graphql.Float,
+		},
+		"period": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"series": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewList(graphql.NewNonNull(graphql.Int)),
+		},
+	},
+})
+
+var scenarioInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "ScenarioInput",
+	Description: "Settings shared by every game of a session. Omitted settings are left as each game has them, except that omitting seed shares a new one.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"lastWeek": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"seed": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"demand": &graphql.InputObjectFieldConfig{
+			Type: demandInputType,
+		},
+		"costModel": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"initialConditions": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+		"fulfilment": &graphql.InputObjectFieldConfig{
+			Type: graphql.Int,
+		},
+	},
+})
+
+func scenarioFromArgs(args map[string]interface{}) Scenario {
+	scenario := Scenario{}
+	if lastWeek, valid := args["lastWeek"].(int); valid {
+		scenario.LastWeek = &lastWeek
+	}
+	if seed, valid := args["seed"].(int); valid {
+		seed64 := int64(seed)
+		scenario.Seed = &seed64
+	}
+	if fields, valid := args["demand"].(map[string]interface{}); valid {
+		demand := demandConfigFromArgs(fields)
+		scenario.Demand = &demand
+	}
+	if costModel, valid := args["costModel"].(int); valid {
+		scenario.CostModel = &costModel
+	}
+	if initial, valid := args["initialConditions"].(int); valid {
+		scenario.Initial = &initial
+	}
+	if fulfilment, valid := args["fulfilment"].(int); valid {
+		scenario.Fulfilment = &fulfilment
+	}
+	return scenario
+}
+
+var startResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "StartResult",
+	Fields: graphql.Fields{
+		"gameId": &graphql.Field{
+			Type: graphql.String,
+		},
+		"started": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"reason": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Why the game could not start.",
+		},
+	},
+})
+
+var demandModelType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "DemandModel",
+	Fields: graphql.Fields{
+		"model": &graphql.Field{
+			Type: nameValueType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				demand := p.Source.(DemandConfig)
+				return DemandModelMappings[demand.Kind], nil
+			},
+		},
+		"base": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"step": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"stepWeek": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"min": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"max": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"mean": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"stdDev": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"amplitude": &graphql.Field{
+			Type: graphql.Float,
+		},
+		"period": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"series": &graphql.Field{
+			Type: graphql.NewList(graphql.Int),
+		},
+	},
+})
+
+var stageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Stage",
+	Fields: graphql.Fields{
+		"role": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"position": &graphql.Field{
+			Type: roleEnum,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(map[string]interface{})["role"], nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"supplier": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "The role that ships to this stage, or 0 if it produces its own goods.",
+		},
+		"shippingDelay": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"orderDelay": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var stageInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "StageInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"supplier": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "A later role in the list, or 0 for a stage that produces its own goods.",
+		},
+		"shippingDelay": &graphql.InputObjectFieldConfig{
+			Type:         graphql.Int,
+			DefaultValue: DEFAULT_SHIPPING_DELAY,
+		},
+		"orderDelay": &graphql.InputObjectFieldConfig{
+			Type:         graphql.Int,
+			DefaultValue: DEFAULT_ORDER_DELAY,
+		},
+	},
+})
+
+var gameType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Game",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"players": &graphql.Field{
+				Type: graphql.NewList(playerType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					players := []*Player{}
+					for _, playerState := range game.PlayerState {
+						for _, id := range append([]string{playerState.PlayerID}, playerState.CoManagers...) {
+							if player := FindPlayer(id); player != nil {
+								players = append(players, player)
+							}
+						}
+					}
+					return players, nil
+				},
+			},
+			"state": &graphql.Field{
+				Type:              nameValueType,
+				DeprecationReason: "Use status.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return GameStateMappings[game.State], nil
+				},
+			},
+			"status": &graphql.Field{
+				Type: graphql.NewNonNull(gameStateEnum),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*Game).State, nil
+				},
+			},
+			"playerState": &graphql.Field{
+				Type: graphql.NewList(publicPlayerStateType),
+			},
+			"lastWeek": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return game.LastWeek, nil
+				},
+			},
+			"demand": &graphql.Field{
+				Type: demandModelType,
+			},
+			"seed": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"sessionId": &graphql.Field{
+				Type: graphql.String,
+			},
+			"week": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"rewindWeeks": &graphql.Field{
+				Type:        graphql.NewList(graphql.Int),
+				Description: "The weeks the host can rewind the game to.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return game.RewindWeeks(), nil
+				},
+			},
+			"analytics": &graphql.Field{
+				Type:        analyticsType,
+				Description: "Debrief statistics, once the game is finished.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					if game.Debrief != nil {
+						return game.Debrief, nil
+					}
+					return nil, nil
+				},
+			},
+			"turnLimit": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Seconds players have to order each week, or 0 for no limit.",
+			},
+			"seats": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "How many players may run each stage together.",
+			},
+			"openRoles": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(roleEnum)),
+				Description: "The roles with a free seat.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*Game).OpenRoles(), nil
+				},
+			},
+			"swapRequests": &graphql.Field{
+				Type: graphql.NewList(swapRequestType),
+			},
+			"defaultOrder": &graphql.Field{
+				Type:        nameValueType,
+				Description: "What players who run out of time order.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return DefaultOrderMappings[game.DefaultOrderPolicy], nil
+				},
+			},
+			"remainingTime": &graphql.Field{
+				Type:        graphql.Float,
+				Description: "Seconds left to order this week, or null without a running turn limit.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					if game.Deadline.IsZero() {
+						return nil, nil
+					}
+					return game.RemainingTime().Seconds(), nil
+				},
+			},
+			"fulfilment": &graphql.Field{
+				Type: nameValueType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return FulfilmentMappings[game.Fulfilment], nil
+				},
+			},
+			"initialConditions": &graphql.Field{
+				Type: initialConditionsType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return game.Initial, nil
+				},
+			},
+			"costModel": &graphql.Field{
+				Type: costModelType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return game.Costs, nil
+				},
+			},
+			"stages": &graphql.Field{
+				Type: graphql.NewList(stageType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					stages := []map[string]interface{}{}
+					for index, stage := range game.Stages {
+						stages = append(stages, map[string]interface{}{
+							"role":          index + 1,
+							"name":          stage.Name,
+							"supplier":      stage.Supplier,
+							"shippingDelay": stage.ShippingDelay,
+							"orderDelay":    stage.OrderDelay,
+						})
+					}
+					return stages, nil
+				},
+			},
+			"roles": &graphql.Field{
+				Type: graphql.NewList(nameValueType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return game.Roles(), nil
+				},
+			},
+			"host": &graphql.Field{
+				Type: playerType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					game := p.Source.(*Game)
+					return FindPlayer(game.HostID), nil
+				},
+			},
+		},
+	},
+)
+
+var queryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"gameExists": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["gameId"].(string)
+				return ExistsGame(id), nil
+			},
+		},
+		"game": &graphql.Field{
+			Type: gameType,
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["gameId"].(string)
+				game := FindGame(id)
+				if game == nil {
+					return nil, nil
+				}
+				return game.Snapshot(), nil
+			},
+		},
+		"playerState": &graphql.Field{
+			Type: privatePlayerStateType,
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"playerId": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["gameId"].(string)
+
+				game := FindGame(id)
+				if game == nil {
+					return nil, nil
+				}
+
+				playerId, _ := p.Args["playerId"].(string)
+				if playerId == "" {
+					playerId = ActingPlayer(p.Context)
+				}
+				game = game.Snapshot()
+				if !game.CanViewPrivateState(ActingPlayer(p.Context), playerId) {
+					return nil, nil
+				}
+				playerState := game.FindPlayerState(playerId)
+				if playerState == nil {
+					return nil, nil
+				}
+
+				return playerState, nil
+			},
+		},
+		"session": &graphql.Field{
+			Type: sessionType,
+			Args: graphql.FieldConfigArgument{
+				"sessionId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["sessionId"].(string)
+				session := FindSession(id)
+				if session == nil {
+					return nil, nil
+				}
+				return session.Snapshot(), nil
+			},
+		},
+		"export": &graphql.Field{
+			Type:        graphql.NewList(exportRowType),
+			Description: "Host only. Every recorded week of every stage, by week and then role.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["gameId"].(string)
+
+				game := FindGame(id)
+				if game == nil {
+					return nil, nil
+				}
+				game = game.Snapshot()
+				if !game.IsHost(ActingPlayer(p.Context)) {
+					return nil, nil
+				}
+
+				return game.Export(), nil
+			},
+		},
+		"player": &graphql.Field{
+			Type: playerType,
+			Args: graphql.FieldConfigArgument{
+				"playerId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerId, _ := p.Args["playerId"].(string)
+				return FindPlayer(playerId), nil
+			},
+		},
+		"gameStates": &graphql.Field{
+			Type:              graphql.NewList(nameValueType),
+			DeprecationReason: "Use the GameState enum.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return GameStateMappings, nil
+			},
+		},
+		"gameRoles": &graphql.Field{
+			Type:              graphql.NewList(nameValueType),
+			DeprecationReason: "Use the Role enum, and the stages of the game for their names.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return GameRoleMappings, nil
+			},
+		},
+		"topologies": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return TopologyMappings, nil
+			},
+		},
+		"defaultOrderPolicies": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return DefaultOrderMappings, nil
+			},
+		},
+		"botStrategies": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return StrategyMappings, nil
+			},
+		},
+		"fulfilmentPolicies": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return FulfilmentMappings, nil
+			},
+		},
+		"initialConditionsPresets": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return InitialConditionsMappings, nil
+			},
+		},
+		"costModels": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return CostModelMappings, nil
+			},
+		},
+		"demandModels": &graphql.Field{
+			Type: graphql.NewList(nameValueType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return DemandModelMappings, nil
+			},
+		},
+	},
+})
+
+var mutationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Mutation",
+	Fields: graphql.Fields{
+		"createPlayer": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Creates a player, or renames the authenticated one, and returns its session token.",
+			Args: graphql.FieldConfigArgument{
+				"playerName": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				playerName, _ := p.Args["playerName"].(string)
+
+				playerId := ActingPlayer(p.Context)
+				if playerId != "" {
+					FindOrCreatePlayer(playerId, playerName)
+					return SessionToken(playerId), nil
+				}
+
+				playerId = NewPlayerID()
+				if CreatePlayer(playerId, playerName) == nil {
+					return nil, NewGameError(ERROR_PLAYER_TAKEN, "the player id %q is taken", playerId)
+				}
+				return SessionToken(playerId), nil
+			},
+		},
+		"addPlayer": &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				gameId, _ := p.Args["gameId"].(string)
+				playerId := ActingPlayer(p.Context)
+				if playerId == "" {
+					return nil, NewGameError(ERROR_NOT_AUTHENTICATED, "sign in to join a game")
+				}
+				if FindPlayer(playerId) == nil {
+					return nil, NewGameError(ERROR_PLAYER_NOT_FOUND, "no player %q", playerId)
+				}
+				game := FindOrCreateGame(gameId, playerId)
+				err := game.Apply(func() error {
+					if err := game.AddPlayer(playerId); err != nil {
+						return err
+					}
+					// A game whose players have all left is hosted by the next to join.
+					if game.HostID == "" {
+						game.HostID = playerId
+					}
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"removePlayer": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Players may remove themselves from a game in the lobby; the host may remove anyone until the game is over. Once the game has started, the stage of a removed player is run by a co-manager or a base stock bot.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"playerId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				gameId, _ := p.Args["gameId"].(string)
+				game := FindGame(gameId)
+				if game == nil {
+					return nil, errGameNotFound(gameId)
+				}
+
+				playerId, _ := p.Args["playerId"].(string)
+				actingPlayerId := ActingPlayer(p.Context)
+				err := game.Apply(func() error {
+					if playerId != actingPlayerId && !game.IsHost(actingPlayerId) {
+						return NewGameError(ERROR_NOT_HOST, "only the host can remove other players")
+					}
+					if game.State != LOBBY && !game.IsHost(actingPlayerId) {
+						return NewGameError(ERROR_NOT_HOST, "only the host can remove players once the game has started")
+					}
+					return game.RemovePlayer(playerId)
+				})
+				if err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"changePlayerRole": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Claims a role, or a seat at it, for the acting player. Fails with ROLE_TAKEN if every seat is taken.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				gameId, _ := p.Args["gameId"].(string)
+				game := FindGame(gameId)
+				if game == nil {
+					return nil, errGameNotFound(gameId)
+				}
+
+				playerId := ActingPlayer(p.Context)
+				role, found := roleFromArgs(p.Args)
+				if !found {
+					return nil, errInvalidArgument("a position is required")
+				}
+				if err := game.Apply(func() error { return game.AssignRole(playerId, role) }); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"startGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return updateAsHost(p, (*Game).Start)
+			},
+		},
+		"submitLastWeek": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"lastWeek": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				lastWeek, _ := p.Args["lastWeek"].(int)
+				if !ValidLastWeek(lastWeek) {
+					return nil, errInvalidArgument("games last 1 to %d weeks", MAX_WEEKS)
+				}
+
+				return updateAsHost(p, func(game *Game) error {
+					if game.State != LOBBY {
+						return errNotInLobby()
+					}
+
+					game.LastWeek = lastWeek
+					return nil
+				})
+			},
+		},
+		"submitDemandModel": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"model": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"base": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"step": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"stepWeek": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"min": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"max": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"mean": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"stdDev": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"amplitude": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"period": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"series": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.NewNonNull(graphql.Int)),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				demand := demandConfigFromArgs(p.Args)
+				if !demand.Valid() {
+					return nil, errInvalidArgument("the demand model is not valid")
+				}
+
+				return updateAsHost(p, func(game *Game) error {
+					if game.State != LOBBY {
+						return errNotInLobby()
+					}
+
+					game.Demand = demand
+					return nil
+				})
+			},
+		},
+		"createSession": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Creates a session facilitated by the acting player.",
+			Args: graphql.FieldConfigArgument{
+				"sessionId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				sessionId, _ := p.Args["sessionId"].(string)
+				playerId := ActingPlayer(p.Context)
+				if playerId == "" {
+					return nil, NewGameError(ERROR_NOT_AUTHENTICATED, "sign in to create a session")
+				}
+				if sessionId == "" {
+					return nil, errInvalidArgument("the session needs an id")
+				}
+				if CreateSession(sessionId, playerId) == nil {
+					return nil, NewGameError(ERROR_SESSION_TAKEN, "the session id %q is taken", sessionId)
+				}
+				return true, nil
+			},
+		},
+		"addSessionGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Facilitator only. Adds a team's game to the session, creating it if needed.",
+			Args: graphql.FieldConfigArgument{
+				"sessionId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				sessionId, _ := p.Args["sessionId"].(string)
+				gameId, _ := p.Args["gameId"].(string)
+				session := FindSession(sessionId)
+				if session == nil {
+					return nil, errSessionNotFound(sessionId)
+				}
+				if !session.IsFacilitator(ActingPlayer(p.Context)) {
+					return nil, errNotFacilitator()
+				}
+				if gameId == "" {
+					return nil, errInvalidArgument("the game needs an id")
+				}
+				if err := session.AddGame(gameId); err != nil {
+					return nil, err
+				}
+				return true, nil
+			},
+		},
+		"startSession": &graphql.Field{
+			Type:        graphql.NewList(startResultType),
+			Description: "Facilitator only. Applies the scenario to every ready game of the session and starts them together.",
+			Args: graphql.FieldConfigArgument{
+				"sessionId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"scenario": &graphql.ArgumentConfig{
+					Type: scenarioInputType,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				sessionId, _ := p.Args["sessionId"].(string)
+				session := FindSession(sessionId)
+				if session == nil {
+					return nil, errSessionNotFound(sessionId)
+				}
+				session = session.Snapshot()
+				if !session.IsFacilitator(ActingPlayer(p.Context)) {
+					return nil, errNotFacilitator()
+				}
+
+				fields, _ := p.Args["scenario"].(map[string]interface{})
+				scenario := scenarioFromArgs(fields)
+				if !scenario.Valid() {
+					return nil, errInvalidArgument("the scenario is not valid")
+				}
+				return session.StartAll(scenario), nil
+			},
+		},
+		"submitTurnLimit": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Limits each week to the given number of seconds; 0 removes the limit.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"seconds": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"defaultOrder": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: DEFAULT_ORDER_REPEAT,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				seconds, _ := p.Args["seconds"].(int)
+				policy, _ := p.Args["defaultOrder"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetTurnLimit(seconds, policy)
+				})
+			},
+		},
+		"addBot": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Fills an empty role with a bot; remove it with removePlayer.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
+				"strategy": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				role, found := roleFromArgs(p.Args)
+				if !found {
+					return nil, errInvalidArgument("a position is required")
+				}
+				strategy, _ := p.Args["strategy"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.AddBot(role, strategy)
+				})
+			},
+		},
+		"submitFulfilment": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Chooses between backlogging and losing unmet demand.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"policy": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				policy, _ := p.Args["policy"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetFulfilment(policy)
+				})
+			},
+		},
+		"submitInitialConditions": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Uses preset starting conditions for every role. The classic preset also sets the classic delays.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"preset": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				preset, _ := p.Args["preset"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetInitialConditions(preset)
+				})
+			},
+		},
+		"submitStageConditions": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Sets the starting conditions of one role, or the default if role is omitted.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"stock": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"backlog": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"shipment": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"order": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				conditions := StageConditions{}
+				conditions.Stock, _ = p.Args["stock"].(int)
+				conditions.Backlog, _ = p.Args["backlog"].(int)
+				conditions.Shipment, _ = p.Args["shipment"].(int)
+				conditions.Order, _ = p.Args["order"].(int)
+				role, _ := roleFromArgs(p.Args)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetStageConditions(role, conditions)
+				})
+			},
+		},
+		"submitCostModel": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Uses preset cost rates for every role.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"model": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				model, _ := p.Args["model"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetCostModel(model)
+				})
+			},
+		},
+		"submitCostRates": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Sets the rates of one role, or the default rates if role is omitted.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"holding": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Float),
+				},
+				"backlog": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Float),
+				},
+				"order": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"lostSale": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"fixedOrder": &graphql.ArgumentConfig{
+					Type: graphql.Float,
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
 			},
-		},
-	},
-})
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				holding, _ := p.Args["holding"].(float64)
+				backlog, _ := p.Args["backlog"].(float64)
+				order, _ := p.Args["order"].(float64)
+				fixedOrder, _ := p.Args["fixedOrder"].(float64)
+				lostSale, _ := p.Args["lostSale"].(float64)
+				role, _ := roleFromArgs(p.Args)
+				rates := CostRates{
+					Holding:    MoneyFromFloat(holding),
+					Backlog:    MoneyFromFloat(backlog),
+					Order:      MoneyFromFloat(order),
+					FixedOrder: MoneyFromFloat(fixedOrder),
+					LostSale:   MoneyFromFloat(lostSale),
+				}
 
-var gameType = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "Game",
-		Fields: graphql.Fields{
-			"id": &graphql.Field{
-				Type: graphql.String,
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetCostRates(role, rates)
+				})
 			},
-			"players": &graphql.Field{
-				Type: graphql.NewList(playerType),
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					game := p.Source.(*Game)
-					players := []*Player{}
-					for _, playerState := range game.PlayerState {
-						player := FindPlayer(playerState.PlayerID)
-						if player != nil {
-							players = append(players, player)
-						}
-					}
-					return players, nil
+		},
+		"submitChain": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Uses a preset supply chain; length applies to linear chains.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
 				},
-			},
-			"state": &graphql.Field{
-				Type: nameValueType,
-				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					game := p.Source.(*Game)
-					return GameStateMappings[game.State], nil
+				"topology": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"length": &graphql.ArgumentConfig{
+					Type: graphql.Int,
 				},
 			},
-			"playerState": &graphql.Field{
-				Type: graphql.NewList(publicPlayerStateType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				topology, _ := p.Args["topology"].(int)
+				length, validLength := p.Args["length"].(int)
+				if !validLength {
+					length = 4
+				}
+
+				var stages []Stage
+				switch topology {
+				case TOPOLOGY_LINEAR:
+					if length < MIN_STAGES || length > MAX_STAGES {
+						return nil, errInvalidArgument("linear chains have %d to %d stages", MIN_STAGES, MAX_STAGES)
+					}
+					stages = LinearStages(length)
+				case TOPOLOGY_DIVERGENT:
+					stages = DivergentStages()
+				default:
+					return nil, errInvalidArgument("there is no topology %d", topology)
+				}
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetStages(stages)
+				})
 			},
 		},
-	},
-)
-
-var queryType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Query",
-	Fields: graphql.Fields{
-		"gameExists": &graphql.Field{
-			Type: graphql.Boolean,
+		"submitStages": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Defines a custom supply chain, listed from the customer towards production.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
+				"stages": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stageInputType))),
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["gameId"].(string)
-				return ExistsGame(id), nil
+				stages := []Stage{}
+				inputs, _ := p.Args["stages"].([]interface{})
+				for _, input := range inputs {
+					fields, _ := input.(map[string]interface{})
+					stage := Stage{}
+					stage.Name, _ = fields["name"].(string)
+					stage.Supplier, _ = fields["supplier"].(int)
+					stage.ShippingDelay, _ = fields["shippingDelay"].(int)
+					stage.OrderDelay, _ = fields["orderDelay"].(int)
+					stages = append(stages, stage)
+				}
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetStages(stages)
+				})
 			},
 		},
-		"game": &graphql.Field{
-			Type: gameType,
+		"submitDelays": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Sets the delays of the link into one role, or of every link if role is omitted.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
+				"shippingDelay": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"orderDelay": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["gameId"].(string)
-				return FindOrCreateGame(id), nil
+				shippingDelay, _ := p.Args["shippingDelay"].(int)
+				orderDelay, _ := p.Args["orderDelay"].(int)
+				role, _ := roleFromArgs(p.Args)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetDelays(role, shippingDelay, orderDelay)
+				})
 			},
 		},
-		"playerState": &graphql.Field{
-			Type: privatePlayerStateType,
+		"submitSeed": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"playerId": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.String),
+				"seed": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				id, _ := p.Args["gameId"].(string)
-
-				game := FindGame(id)
-				if game == nil {
-					return nil, nil
+				seed, _ := p.Args["seed"].(int)
+				if seed < 0 {
+					return nil, errInvalidArgument("seeds cannot be negative")
 				}
 
-				playerId, _ := p.Args["playerId"].(string)
-				playerState := game.FindPlayerState(playerId)
-				if playerState == nil {
-					return nil, nil
-				}
+				return updateAsHost(p, func(game *Game) error {
+					if game.State != LOBBY {
+						return errNotInLobby()
+					}
 
-				return playerState, nil
+					game.Seed = int64(seed)
+					return nil
+				})
 			},
 		},
-		"player": &graphql.Field{
-			Type: playerType,
+		"pauseGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
 			Args: graphql.FieldConfigArgument{
-				"playerId": &graphql.ArgumentConfig{
+				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerId, _ := p.Args["playerId"].(string)
-				return FindPlayer(playerId), nil
+				return updateAsHost(p, (*Game).Pause)
 			},
 		},
-		"gameStates": &graphql.Field{
-			Type: graphql.NewList(nameValueType),
+		"resumeGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				return GameStateMappings, nil
+				return updateAsHost(p, (*Game).Resume)
 			},
 		},
-		"gameRoles": &graphql.Field{
-			Type: graphql.NewList(nameValueType),
+		"advanceWeek": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Ends the current week. Pending orders are locked in, and anyone without one places the game's default order.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				return GameRoleMappings, nil
+				return updateAsHost(p, (*Game).ForceStep)
 			},
 		},
-	},
-})
-
-var mutationType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "Mutation",
-	Fields: graphql.Fields{
-		"createPlayer": &graphql.Field{
-			Type: graphql.Boolean,
+		"endGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
 			Args: graphql.FieldConfigArgument{
-				"playerId": &graphql.ArgumentConfig{
+				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"playerName": &graphql.ArgumentConfig{
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return updateAsHost(p, (*Game).End)
+			},
+		},
+		"rewindGame": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Restores the game to the start of an earlier week and pauses it.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
+				"week": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				playerId, _ := p.Args["playerId"].(string)
-				playerName, _ := p.Args["playerName"].(string)
-				return FindOrCreatePlayer(playerId, playerName), nil
+				week, _ := p.Args["week"].(int)
+
+				return updateAsHost(p, func(game *Game) error {
+					return game.Rewind(week)
+				})
 			},
 		},
-		"addPlayer": &graphql.Field{
-			Type: graphql.Boolean,
+		"releaseRole": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Gives up the acting player's role. A co-manager takes over the stage, if there is one.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return updateAsPlayer(p, func(game *Game, playerId string) error {
+					return game.AssignRole(playerId, NONE)
+				})
+			},
+		},
+		"requestSwap": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Asks another player to trade roles with the acting player.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
@@ -553,20 +2527,15 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				gameId, _ := p.Args["gameId"].(string)
-				game := FindOrCreateGame(gameId)
-				playerId, _ := p.Args["playerId"].(string)
-				player := FindPlayer(playerId)
-				if player == nil {
-					return false, nil
-				}
-				added := game.AddPlayer(playerId)
-				Subscriptions.broadcast()
-				return added, nil
+				otherId, _ := p.Args["playerId"].(string)
+				return updateAsPlayer(p, func(game *Game, playerId string) error {
+					return game.RequestSwap(playerId, otherId)
+				})
 			},
 		},
-		"removePlayer": &graphql.Field{
-			Type: graphql.Boolean,
+		"answerSwap": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Accepts or declines a swap the given player asked the acting player for.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
@@ -574,18 +2543,21 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				"playerId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
+				"accept": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Boolean),
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				gameId, _ := p.Args["gameId"].(string)
-				game := FindOrCreateGame(gameId)
-				playerId, _ := p.Args["playerId"].(string)
-				removed := game.RemovePlayer(playerId)
-				Subscriptions.broadcast()
-				return removed, nil
+				otherId, _ := p.Args["playerId"].(string)
+				accept, _ := p.Args["accept"].(bool)
+				return updateAsPlayer(p, func(game *Game, playerId string) error {
+					return game.AnswerSwap(playerId, otherId, accept)
+				})
 			},
 		},
-		"changePlayerRole": &graphql.Field{
-			Type: graphql.Boolean,
+		"cancelSwap": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Withdraws the acting player's request to swap with the given player.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
@@ -593,51 +2565,70 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				"playerId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"role": &graphql.ArgumentConfig{
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				otherId, _ := p.Args["playerId"].(string)
+				return updateAsPlayer(p, func(game *Game, playerId string) error {
+					return game.CancelSwap(playerId, otherId)
+				})
+			},
+		},
+		"submitSeats": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only. Lets up to the given number of players run each stage together.",
+			Args: graphql.FieldConfigArgument{
+				"gameId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"seats": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				gameId, _ := p.Args["gameId"].(string)
-				game := FindGame(gameId)
-				if game == nil {
-					return false, nil
-				}
-
-				playerId, _ := p.Args["playerId"].(string)
-				playerState := game.FindPlayerState(playerId)
-				if playerState == nil {
-					return false, nil
-				}
+				seats, _ := p.Args["seats"].(int)
 
-				role, _ := p.Args["role"].(int)
-				playerState.Role = role
-				Subscriptions.broadcast()
-				return true, nil
+				return updateAsHost(p, func(game *Game) error {
+					return game.SetSeats(seats)
+				})
 			},
 		},
-		"startGame": &graphql.Field{
-			Type: graphql.Boolean,
+		"assignRole": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Host only.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
+				"playerId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"role": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "Deprecated: use position.",
+				},
+				"position": &graphql.ArgumentConfig{
+					Type: roleEnum,
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				gameId, _ := p.Args["gameId"].(string)
-				game := FindOrCreateGame(gameId)
-				started := game.Start()
-				Subscriptions.broadcast()
-				return started, nil
+				playerId, _ := p.Args["playerId"].(string)
+				role, found := roleFromArgs(p.Args)
+				if !found {
+					return nil, errInvalidArgument("a position is required")
+				}
+				return updateAsHost(p, func(game *Game) error {
+					return game.AssignRole(playerId, role)
+				})
 			},
 		},
-		"submitLastWeek": &graphql.Field{
-			Type: graphql.Boolean,
+		"submitOutgoing": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Sets the acting player's order for this week. It can be changed until it is locked in.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"lastWeek": &graphql.ArgumentConfig{
+				"outgoing": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
 			},
@@ -645,57 +2636,62 @@ var mutationType = graphql.NewObject(graphql.ObjectConfig{
 				gameId, _ := p.Args["gameId"].(string)
 				game := FindGame(gameId)
 				if game == nil {
-					return false, nil
+					return nil, errGameNotFound(gameId)
 				}
 
-				if game.State != LOBBY {
-					return false, nil
+				playerId := ActingPlayer(p.Context)
+				outgoing, _ := p.Args["outgoing"].(int)
+				if outgoing < 0 || outgoing > MAX_ORDER {
+					return nil, NewGameError(ERROR_INVALID_ORDER, "orders must be 0 to %d", MAX_ORDER)
 				}
 
-				lastWeek, validLastWeek := p.Args["lastWeek"].(int)
-				if !validLastWeek {
-					return false, nil
-				}
+				err := game.Apply(func() error {
+					playerState, err := game.orderingPlayer(playerId)
+					if err != nil {
+						return err
+					}
 
-				game.LastWeek = lastWeek
-				Subscriptions.broadcast()
+					playerState.Outgoing = outgoing
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
 				return true, nil
 			},
 		},
-		"submitOutgoing": &graphql.Field{
-			Type: graphql.Boolean,
+		"lockOrder": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Locks in the acting player's order. The week ends once every order is locked in.",
 			Args: graphql.FieldConfigArgument{
 				"gameId": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
-				"playerId": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.String),
-				},
-				"outgoing": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.Int),
-				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				gameId, _ := p.Args["gameId"].(string)
 				game := FindGame(gameId)
 				if game == nil {
-					return false, nil
+					return nil, errGameNotFound(gameId)
 				}
 
-				playerId, _ := p.Args["playerId"].(string)
-				playerState := game.FindPlayerState(playerId)
-				if playerState == nil {
-					return false, nil
-				}
+				playerId := ActingPlayer(p.Context)
+				err := game.Apply(func() error {
+					playerState, err := game.orderingPlayer(playerId)
+					if err != nil {
+						return err
+					}
+					if playerState.Outgoing == -1 {
+						return NewGameError(ERROR_NO_ORDER, "enter an order before locking it in")
+					}
 
-				outgoing, validOutgoing := p.Args["outgoing"].(int)
-				if !validOutgoing {
-					return false, nil
+					playerState.Ready = true
+					game.TryStep()
+					return nil
+				})
+				if err != nil {
+					return nil, err
 				}
-
-				playerState.Outgoing = outgoing
-				game.TryStep()
-				Subscriptions.broadcast()
 				return true, nil
 			},
 		},
@@ -714,7 +2710,11 @@ var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				id, _ := p.Args["gameId"].(string)
-				return FindOrCreateGame(id), nil
+				game := FindGame(id)
+				if game == nil {
+					return nil, nil
+				}
+				return game.Snapshot(), nil
 			},
 		},
 		"playerState": &graphql.Field{
@@ -724,7 +2724,7 @@ var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
 					Type: graphql.NewNonNull(graphql.String),
 				},
 				"playerId": &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.String),
+					Type: graphql.String,
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
@@ -736,6 +2736,13 @@ var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
 				}
 
 				playerId, _ := p.Args["playerId"].(string)
+				if playerId == "" {
+					playerId = ActingPlayer(p.Context)
+				}
+				game = game.Snapshot()
+				if !game.CanViewPrivateState(ActingPlayer(p.Context), playerId) {
+					return nil, nil
+				}
 				playerState := game.FindPlayerState(playerId)
 				if playerState == nil {
 					return nil, nil
@@ -744,6 +2751,22 @@ var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
 				return playerState, nil
 			},
 		},
+		"session": &graphql.Field{
+			Type: sessionType,
+			Args: graphql.FieldConfigArgument{
+				"sessionId": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["sessionId"].(string)
+				session := FindSession(id)
+				if session == nil {
+					return nil, nil
+				}
+				return session.Snapshot(), nil
+			},
+		},
 	},
 })
 
@@ -771,112 +2794,23 @@ func (h SinglePageAppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	http.FileServer(http.Dir(h.Directory)).ServeHTTP(w, r)
 }
 
-type Subscriber struct {
-	ID            int
-	Conn          *websocket.Conn
-	RequestString string
-	Variables     map[string]interface{}
-	OperationID   string
-}
-
-type SubscriptionHandler struct {
-	Schema      *graphql.Schema
-	NextID      int
-	Subscribers []Subscriber
-}
-
-var Subscriptions SubscriptionHandler
-
-type SubscriptionMessage struct {
-	OperationID string `json:"id,omitempty"`
-	Type        string `json:"type"`
-	Payload     struct {
-		Query     string                 `json:"query"`
-		Variables map[string]interface{} `json:"variables"`
-	} `json:"payload,omitempty"`
-}
-
-func (h *SubscriptionHandler) uniqueId() int {
-	id := h.NextID
-	h.NextID += 1
-	return id
-}
-
-func (h *SubscriptionHandler) handler(ws *websocket.Conn) {
-	for {
-		var msg SubscriptionMessage
-		if err := websocket.JSON.Receive(ws, &msg); err != nil {
-			break
-		}
-
-		switch msg.Type {
-		case "connection_init":
-		case "start":
-			subscriber := Subscriber{
-				ID:            h.uniqueId(),
-				Conn:          ws,
-				RequestString: msg.Payload.Query,
-				Variables:     msg.Payload.Variables,
-				OperationID:   msg.OperationID,
-			}
-			h.Subscribers = append(h.Subscribers, subscriber)
-			go h.initilizeSubscriber(&subscriber)
-		case "stop":
-		default:
-			println("Unknown message:", msg.Type)
-		}
-	}
-}
-
-func (h *SubscriptionHandler) removeSubscriber(id int) {
-	for index, subscriber := range h.Subscribers {
-		if subscriber.ID == id {
-			h.Subscribers = append(h.Subscribers[:index], h.Subscribers[index+1:]...)
-			return
-		}
-	}
-}
-
-func (subscriber *Subscriber) broadcast(schema *graphql.Schema) bool {
-	payload := graphql.Do(graphql.Params{
-		Schema:         *schema,
-		RequestString:  subscriber.RequestString,
-		VariableValues: subscriber.Variables,
-	})
-	msg := map[string]interface{}{
-		"type":    "data",
-		"id":      subscriber.OperationID,
-		"payload": payload,
-	}
-	if err := websocket.JSON.Send(subscriber.Conn, msg); err != nil {
-		return false
+func main() {
+	databasePath := os.Getenv("BEERGAME_DB")
+	if databasePath == "" {
+		databasePath = "beergame.db"
 	}
-	return true
-}
-
-func (h *SubscriptionHandler) initilizeSubscriber(subscriber *Subscriber) {
-	time.Sleep(100 * time.Millisecond)
-	succeeded := subscriber.broadcast(h.Schema)
-	if !succeeded {
-		h.removeSubscriber(subscriber.ID)
+	store, err := OpenBoltStore(databasePath)
+	if err != nil {
+		log.Fatal(err)
 	}
-}
-
-func (h *SubscriptionHandler) broadcast() {
-	invalidSubscriptions := []int{}
-	for _, subscriber := range h.Subscribers {
-		succeeded := subscriber.broadcast(h.Schema)
-		if !succeeded {
-			invalidSubscriptions = append(invalidSubscriptions, subscriber.ID)
-		}
+	defer store.Close()
+	if err := LoadStore(store); err != nil {
+		log.Fatal(err)
 	}
-
-	for _, id := range invalidSubscriptions {
-		h.removeSubscriber(id)
+	if err := InitSessionSecret(store); err != nil {
+		log.Fatal(err)
 	}
-}
 
-func main() {
 	mux := http.NewServeMux()
 
 	appHandler := SinglePageAppHandler{
@@ -891,19 +2825,28 @@ func main() {
 		Subscription: subscriptionType,
 	})
 
-	graphqlHandler := handler.New(&handler.Config{
+	graphqlHandler := Authenticate(handler.New(&handler.Config{
 		Schema:   &schema,
 		Pretty:   true,
 		GraphiQL: true,
-	})
+	}))
 	mux.Handle("/graphql", graphqlHandler)
 	mux.Handle("/graphql/", graphqlHandler)
 
 	Subscriptions = SubscriptionHandler{
 		Schema: &schema,
 	}
-	mux.Handle("/wsgraphql", websocket.Handler(Subscriptions.handler))
+	mux.Handle("/wsgraphql", websocket.Server{
+		Handshake: Subscriptions.handshake,
+		Handler:   Subscriptions.handler,
+	})
+	StartTimers()
+
+	mux.Handle("/export/", Authenticate(http.HandlerFunc(ExportHandler)))
 
-	handler := cors.Default().Handler(mux)
+	handler := cors.New(cors.Options{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodHead},
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization"},
+	}).Handler(mux)
 	http.ListenAndServe("0.0.0.0:80", handler)
 }
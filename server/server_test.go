@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+var (
+	schemaOnce  sync.Once
+	schema      graphql.Schema
+	schemaError error
+)
+
+// testSchema builds the schema once, since subscribers started by one test
+// can still be using the handler while the next one runs.
+func testSchema(t testing.TB) *graphql.Schema {
+	schemaOnce.Do(func() {
+		schema, schemaError = graphql.NewSchema(graphql.SchemaConfig{
+			Query:        queryType,
+			Mutation:     mutationType,
+			Subscription: subscriptionType,
+		})
+		Subscriptions = SubscriptionHandler{Schema: &schema}
+	})
+	if schemaError != nil {
+		t.Fatal(schemaError)
+	}
+	return &schema
+}
+
+func execute(schema *graphql.Schema, playerID string, request string) *graphql.Result {
+	return graphql.Do(graphql.Params{
+		Schema:        *schema,
+		RequestString: request,
+		Context:       WithPlayer(context.Background(), playerID),
+	})
+}
+
+// newTestGame creates a game in the lobby with a human in every role.
+func newTestGame(t testing.TB, id string, players []string) *Game {
+	gamesLock.Lock()
+	delete(Games, id)
+	gamesLock.Unlock()
+	game := FindOrCreateGame(id, players[0])
+	err := game.Apply(func() error {
+		for index, playerID := range players {
+			if err := game.AddPlayer(playerID); err != nil {
+				return err
+			}
+			if err := game.AssignRole(playerID, index+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+// TestConcurrentOrders has every player order and lock in at once, week after
+// week, while others read the game. Run it with -race.
+func TestConcurrentOrders(t *testing.T) {
+	schema := testSchema(t)
+	players := []string{"concurrent-1", "concurrent-2", "concurrent-3", "concurrent-4"}
+	game := newTestGame(t, "concurrent", players)
+	if err := game.Apply(game.Start); err != nil {
+		t.Fatal(err)
+	}
+
+	const weeks = 5
+	week := func() int {
+		return game.Snapshot().Week
+	}
+
+	var wait sync.WaitGroup
+	for _, playerID := range players {
+		wait.Add(1)
+		go func(playerID string) {
+			defer wait.Done()
+			for week() < weeks {
+				execute(schema, playerID, `mutation { submitOutgoing(gameId: "concurrent", outgoing: 4) }`)
+				execute(schema, playerID, `mutation { lockOrder(gameId: "concurrent") }`)
+			}
+		}(playerID)
+	}
+	for reader := 0; reader < 2; reader++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for week() < weeks {
+				result := execute(schema, players[0], `{ game(gameId: "concurrent") { week playerState { ready } } playerState(gameId: "concurrent") { stock history { week } } }`)
+				if len(result.Errors) > 0 {
+					t.Error(result.Errors)
+					return
+				}
+			}
+		}()
+	}
+	wait.Wait()
+
+	snapshot := game.Snapshot()
+	for _, playerState := range snapshot.PlayerState {
+		if len(playerState.History) < weeks {
+			t.Fatalf("%s has %d weeks of history, want at least %d", playerState.PlayerID, len(playerState.History), weeks)
+		}
+		for index, record := range playerState.History {
+			if record.Week != index || record.Ordered != 4 {
+				t.Errorf("%s week %d: got week %d, ordered %d", playerState.PlayerID, index, record.Week, record.Ordered)
+			}
+		}
+	}
+}
+
+func TestSnapshotLeavesOutSavedStages(t *testing.T) {
+	players := []string{"snapshot-1", "snapshot-2", "snapshot-3", "snapshot-4"}
+	game := newTestGame(t, "snapshot", players)
+	game.Apply(game.Start)
+	game.Apply(game.ForceStep)
+
+	snapshot := game.Snapshot()
+	if got := fmt.Sprint(snapshot.RewindWeeks()); got != "[0 1]" {
+		t.Errorf("got rewind weeks %s, want [0 1]", got)
+	}
+	for _, saved := range snapshot.Snapshots {
+		if saved.PlayerState != nil {
+			t.Errorf("week %d snapshot was copied with its stages", saved.Week)
+		}
+	}
+	if len(game.Snapshots[1].PlayerState) != len(players) {
+		t.Errorf("taking a snapshot changed the game's saved stages")
+	}
+}
+
+func TestBotIDsAreReserved(t *testing.T) {
+	secret := sessionSecret
+	sessionSecret = []byte("test secret")
+	defer func() { sessionSecret = secret }()
+
+	if _, valid := VerifySessionToken(SessionToken("player")); !valid {
+		t.Fatal("a player's session token was rejected")
+	}
+	if CreatePlayer(BotID(1), "impostor") != nil {
+		t.Error("a player registered a bot's id")
+	}
+	if _, valid := VerifySessionToken(SessionToken(BotID(1))); valid {
+		t.Error("a session token for a bot's id was accepted")
+	}
+}
+
+func TestGameQueryDoesNotCreateGames(t *testing.T) {
+	schema := testSchema(t)
+	result := execute(schema, "visitor", `{ game(gameId: "unknown") { id } }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	if game := result.Data.(map[string]interface{})["game"]; game != nil {
+		t.Errorf("got game %v, want null", game)
+	}
+	if ExistsGame("unknown") {
+		t.Error("querying a game created it")
+	}
+}
+
+func TestLastWeekLimit(t *testing.T) {
+	schema := testSchema(t)
+	newTestGame(t, "long", []string{"long-1"})
+
+	tests := []struct {
+		lastWeek int
+		valid    bool
+	}{
+		{0, false},
+		{1, true},
+		{MAX_WEEKS, true},
+		{MAX_WEEKS + 1, false},
+		{2000000000, false},
+	}
+	for _, test := range tests {
+		result := execute(schema, "long-1", fmt.Sprintf(`mutation { submitLastWeek(gameId: "long", lastWeek: %d) }`, test.lastWeek))
+		if valid := len(result.Errors) == 0; valid != test.valid {
+			t.Errorf("submitLastWeek(%d) gave errors %v", test.lastWeek, result.Errors)
+		}
+		if !test.valid && len(result.Errors) > 0 {
+			if code := result.Errors[0].Extensions["code"]; code != ERROR_INVALID_ARGUMENT {
+				t.Errorf("submitLastWeek(%d) failed with %v, want %s", test.lastWeek, code, ERROR_INVALID_ARGUMENT)
+			}
+		}
+		lastWeek := test.lastWeek
+		if valid := (Scenario{LastWeek: &lastWeek}).Valid(); valid != test.valid {
+			t.Errorf("a scenario lasting %d weeks is valid: %v", test.lastWeek, valid)
+		}
+	}
+}
+
+func TestPositionsAreNeutral(t *testing.T) {
+	schema := testSchema(t)
+	game := newTestGame(t, "positions", []string{"positions-1", "positions-2"})
+	game.Apply(func() error { return game.SetStages(DivergentStages()) })
+	game.Apply(func() error { return game.AssignRole("positions-2", 2) })
+
+	result := execute(schema, "positions-1", `{ game(gameId: "positions") { playerState { position stage } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	got := fmt.Sprint(result.Data)
+	if want := "map[game:map[playerState:[map[position:STAGE_1 stage:retailer a] map[position:STAGE_2 stage:retailer b]]]]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// chainGame starts a game on stages with a player in every role and
+// constant demand.
+func chainGame(t *testing.T, id string, stages []Stage, initial InitialConditions, demand int) *Game {
+	gamesLock.Lock()
+	delete(Games, id)
+	gamesLock.Unlock()
+	game := FindOrCreateGame(id, "")
+	err := game.Apply(func() error {
+		if err := game.SetStages(stages); err != nil {
+			return err
+		}
+		for role := 1; role <= len(stages); role++ {
+			playerID := fmt.Sprintf("%s-%d", id, role)
+			if err := game.AddPlayer(playerID); err != nil {
+				return err
+			}
+			if err := game.AssignRole(playerID, role); err != nil {
+				return err
+			}
+		}
+		game.Demand = DemandConfig{Kind: DEMAND_CONSTANT, Base: demand}
+		game.Initial = initial
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+// playWeeks has every role order orders[role] for weeks weeks.
+func playWeeks(t *testing.T, game *Game, orders []int, weeks int) {
+	for week := 0; week < weeks; week++ {
+		err := game.Apply(func() error {
+			for _, playerState := range game.PlayerState {
+				playerState.Outgoing = orders[playerState.Role]
+				playerState.Ready = true
+			}
+			if !game.TryStep() {
+				return fmt.Errorf("week %d did not advance", game.Week)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stageSummaries describes each stage, indexed by role.
+func stageSummaries(game *Game) []string {
+	stages, _ := game.StagePlayers()
+	summaries := []string{""}
+	for role := 1; role < len(stages); role++ {
+		p := stages[role]
+		summaries = append(summaries, fmt.Sprintf("stock %d backlog %d shipments %v orders %v", p.Stock, p.Backlog, p.Shipments, p.Orders))
+	}
+	return summaries
+}
+
+// withDelays sets the delays of every stage.
+func withDelays(stages []Stage, shippingDelay int, orderDelay int) []Stage {
+	for index := range stages {
+		stages[index].ShippingDelay = shippingDelay
+		stages[index].OrderDelay = orderDelay
+	}
+	return stages
+}
+
+func TestChainSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		stages  []Stage
+		initial InitialConditions
+		demand  int
+		orders  []int
+		weeks   int
+		want    []string
+	}{
+		{
+			// The retailer over-orders, and the manufacturer produces too
+			// little to keep up from the third week.
+			name:    "two stages",
+			stages:  withDelays(LinearStages(2), 1, 0),
+			initial: InitialConditions{Default: StageConditions{Stock: 10}},
+			demand:  4,
+			orders:  []int{0, 6, 2},
+			weeks:   3,
+			want: []string{"",
+				"stock 10 backlog 0 shipments [2] orders []",
+				"stock 0 backlog 4 shipments [2] orders []",
+			},
+		},
+		{
+			// Everyone orders one more than the retailer sells, so only the
+			// retailer builds up stock.
+			name:    "eight stages",
+			stages:  withDelays(LinearStages(8), 1, 0),
+			initial: InitialConditions{Default: StageConditions{Stock: 10}},
+			demand:  4,
+			orders:  []int{0, 5, 5, 5, 5, 5, 5, 5, 5},
+			weeks:   3,
+			want: []string{"",
+				"stock 8 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+				"stock 5 backlog 0 shipments [5] orders []",
+			},
+		},
+		{
+			// The distributer owes 6 to wholesaler a and 3 to wholesaler b
+			// but has only 5, which it splits 4 to 1.
+			name:   "divergent short shipment",
+			stages: withDelays(DivergentStages(), 1, 0),
+			initial: InitialConditions{
+				Default: StageConditions{Stock: 10},
+				Roles:   map[int]StageConditions{5: {Stock: 5}},
+			},
+			demand: 0,
+			orders: []int{0, 0, 0, 6, 3, 0, 0},
+			weeks:  1,
+			want: []string{"",
+				"stock 10 backlog 0 shipments [0] orders []",
+				"stock 10 backlog 0 shipments [0] orders []",
+				"stock 10 backlog 0 shipments [4] orders []",
+				"stock 10 backlog 0 shipments [1] orders []",
+				"stock 0 backlog 4 shipments [0] orders []",
+				"stock 10 backlog 0 shipments [0] orders []",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := chainGame(t, "chain", test.stages, test.initial, test.demand)
+			playWeeks(t, game, test.orders, test.weeks)
+			got := stageSummaries(game)
+			for role := 1; role < len(test.want); role++ {
+				if got[role] != test.want[role] {
+					t.Errorf("%s: got %s, want %s", game.Stage(role).Name, got[role], test.want[role])
+				}
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		amount int
+		owed   map[int]int
+		want   map[int]int
+	}{
+		{5, map[int]int{3: 6, 4: 3}, map[int]int{3: 4, 4: 1}},
+		{9, map[int]int{3: 6, 4: 3}, map[int]int{3: 6, 4: 3}},
+		{20, map[int]int{3: 6, 4: 3}, map[int]int{3: 6, 4: 3}},
+		{3, map[int]int{1: 2, 2: 2, 3: 2}, map[int]int{1: 1, 2: 1, 3: 1}},
+		{1, map[int]int{1: 2, 2: 2}, map[int]int{1: 1, 2: 0}},
+		{4, map[int]int{1: 0, 2: 5}, map[int]int{2: 4}},
+	}
+	for _, test := range tests {
+		if got := Allocate(test.amount, test.owed); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Allocate(%d, %v) = %v, want %v", test.amount, test.owed, got, test.want)
+		}
+	}
+}
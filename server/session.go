@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// A Session groups the games of teams playing side by side, e.g. a class.
+// The facilitator who created it hosts every game in it.
+type Session struct {
+	ID            string   `json:"id"`
+	FacilitatorID string   `json:"facilitatorId"`
+	GameIDs       []string `json:"games"`
+
+	lock sync.Mutex
+}
+
+var Sessions = map[string]*Session{}
+var sessionsLock sync.Mutex
+
+func SessionTopic(sessionID string) string {
+	return "session/" + sessionID
+}
+
+func FindSession(id string) *Session {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	return Sessions[id]
+}
+
+// CreateSession returns nil if the id is taken.
+func CreateSession(id string, facilitatorID string) *Session {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	if _, found := Sessions[id]; found || id == "" {
+		return nil
+	}
+	session := &Session{
+		ID:            id,
+		FacilitatorID: facilitatorID,
+		GameIDs:       []string{},
+	}
+	Sessions[id] = session
+	session.Save()
+	return session
+}
+
+func (session *Session) IsFacilitator(playerID string) bool {
+	return playerID != "" && session.FacilitatorID == playerID
+}
+
+// Update runs update with the session locked, then saves it and notifies
+// subscribers if update reports a change.
+func (session *Session) Update(update func() bool) bool {
+	session.lock.Lock()
+	changed := update()
+	if changed {
+		session.Save()
+	}
+	session.lock.Unlock()
+
+	if changed {
+		Subscriptions.publish(SessionTopic(session.ID))
+	}
+	return changed
+}
+
+// Snapshot returns a deep copy of the session that can be read without
+// holding its lock.
+func (session *Session) Snapshot() *Session {
+	session.lock.Lock()
+	data, err := json.Marshal(session)
+	session.lock.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	snapshot := &Session{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		panic(err)
+	}
+	return snapshot
+}
+
+// AddGame adds a team's game to the session, creating it if needed. An
+// existing game must be hosted by the facilitator and not be in a session.
+// The game is claimed before the session is locked, since publishing either
+// resolves the other.
+func (session *Session) AddGame(gameID string) error {
+	game := FindOrCreateGame(gameID, session.FacilitatorID)
+	err := game.Apply(func() error {
+		if !game.IsHost(session.FacilitatorID) {
+			return NewGameError(ERROR_NOT_HOST, "the facilitator does not host %s", gameID)
+		}
+		if game.SessionID != "" {
+			return NewGameError(ERROR_IN_SESSION, "%s is already in a session", gameID)
+		}
+		game.SessionID = session.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	session.Update(func() bool {
+		session.GameIDs = append(session.GameIDs, gameID)
+		return true
+	})
+	return nil
+}
+
+// Games returns a snapshot of every game in the session.
+func (session *Session) Games() []*Game {
+	games := []*Game{}
+	for _, id := range session.GameIDs {
+		if game := FindGame(id); game != nil {
+			games = append(games, game.Snapshot())
+		}
+	}
+	return games
+}
+
+// Team summarises one game of a session for the facilitator's dashboard.
+type Team struct {
+	Rank  int   `json:"rank"`
+	Game  *Game `json:"game"`
+	Week  int   `json:"week"`
+	State int   `json:"state"`
+	Cost  Money `json:"cost"`
+}
+
+func (game *Game) TotalCost() Money {
+	total := Money(0)
+	for _, playerState := range game.PlayerState {
+		total += playerState.Costs
+	}
+	return total
+}
+
+func (session *Session) Teams() []Team {
+	teams := []Team{}
+	for _, game := range session.Games() {
+		teams = append(teams, Team{
+			Game:  game,
+			Week:  game.Week,
+			State: game.State,
+			Cost:  game.TotalCost(),
+		})
+	}
+	return teams
+}
+
+// Leaderboard ranks the finished teams by total cost, lowest first. Teams
+// with equal costs share a rank.
+func (session *Session) Leaderboard() []Team {
+	teams := []Team{}
+	for _, team := range session.Teams() {
+		if team.State == FINISHED {
+			teams = append(teams, team)
+		}
+	}
+	sort.SliceStable(teams, func(i, j int) bool {
+		return teams[i].Cost < teams[j].Cost
+	})
+	for index := range teams {
+		teams[index].Rank = index + 1
+		if index > 0 && teams[index].Cost == teams[index-1].Cost {
+			teams[index].Rank = teams[index-1].Rank
+		}
+	}
+	return teams
+}
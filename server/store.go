@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists games, players and sessions so that they survive a restart.
+// Everything is loaded into memory at startup and written through on change.
+type Store interface {
+	LoadGames() ([]*Game, error)
+	LoadPlayers() ([]*Player, error)
+	LoadSessions() ([]*Session, error)
+	SaveGame(game *Game) error
+	SavePlayer(player *Player) error
+	SaveSession(session *Session) error
+	LoadSecret() ([]byte, error)
+	Close() error
+}
+
+var Storage Store = MemoryStore{}
+
+// MemoryStore keeps nothing; games only live as long as the process.
+type MemoryStore struct{}
+
+func (MemoryStore) LoadGames() ([]*Game, error)        { return []*Game{}, nil }
+func (MemoryStore) LoadPlayers() ([]*Player, error)    { return []*Player{}, nil }
+func (MemoryStore) LoadSessions() ([]*Session, error)  { return []*Session{}, nil }
+func (MemoryStore) SaveGame(game *Game) error          { return nil }
+func (MemoryStore) SavePlayer(player *Player) error    { return nil }
+func (MemoryStore) SaveSession(session *Session) error { return nil }
+func (MemoryStore) LoadSecret() ([]byte, error)        { return NewSecret() }
+func (MemoryStore) Close() error                       { return nil }
+
+var (
+	gamesBucket    = []byte("games")
+	playersBucket  = []byte("players")
+	sessionsBucket = []byte("sessions")
+	metaBucket     = []byte("meta")
+	secretKey      = []byte("secret")
+)
+
+// BoltStore stores each game and player as a JSON document in a BoltDB file.
+type BoltStore struct {
+	DB *bolt.DB
+}
+
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{gamesBucket, playersBucket, sessionsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{DB: db}, nil
+}
+
+func (s *BoltStore) LoadGames() ([]*Game, error) {
+	games := []*Game{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(gamesBucket).ForEach(func(key, value []byte) error {
+			game := &Game{}
+			if err := json.Unmarshal(value, game); err != nil {
+				return err
+			}
+			if err := migrateLegacy(game, value); err != nil {
+				return err
+			}
+			games = append(games, game)
+			return nil
+		})
+	})
+	return games, err
+}
+
+// migrateLegacy upgrades games saved by older versions. Those kept two
+// fixed shipment slots instead of a shipment pipeline, costs in whole units
+// under a fixed cost model, and always started with 15 in stock. Before
+// orders could be revised, an order was final as soon as it was submitted.
+func migrateLegacy(game *Game, value []byte) error {
+	legacy := struct {
+		PlayerState []struct {
+			Pending0 int              `json:"pending0"`
+			Pending1 int              `json:"pending1"`
+			Ready    *json.RawMessage `json:"ready"`
+		} `json:"playerState"`
+		CostModel *json.RawMessage `json:"costModel"`
+		Initial   *json.RawMessage `json:"initial"`
+	}{}
+	if err := json.Unmarshal(value, &legacy); err != nil {
+		return err
+	}
+	for index, playerState := range game.PlayerState {
+		if playerState.Shipments == nil && game.State != LOBBY && index < len(legacy.PlayerState) {
+			pending := legacy.PlayerState[index]
+			playerState.Shipments = Pipeline{pending.Pending0, pending.Pending1}
+			playerState.Orders = Pipeline{}
+		}
+		if index < len(legacy.PlayerState) && legacy.PlayerState[index].Ready == nil {
+			if playerState.Outgoing != -1 && game.State != LOBBY {
+				playerState.Ready = true
+			}
+		}
+	}
+	if legacy.Initial == nil {
+		game.Initial = DefaultInitialConditions()
+	}
+	if legacy.CostModel == nil {
+		game.Costs = DefaultCostModel()
+		for _, playerState := range game.PlayerState {
+			playerState.Costs *= 100
+			for index := range playerState.CostPrev {
+				playerState.CostPrev[index] *= 100
+			}
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) LoadPlayers() ([]*Player, error) {
+	players := []*Player{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(playersBucket).ForEach(func(key, value []byte) error {
+			player := &Player{}
+			if err := json.Unmarshal(value, player); err != nil {
+				return err
+			}
+			players = append(players, player)
+			return nil
+		})
+	})
+	return players, err
+}
+
+func (s *BoltStore) LoadSessions() ([]*Session, error) {
+	sessions := []*Session{}
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(key, value []byte) error {
+			session := &Session{}
+			if err := json.Unmarshal(value, session); err != nil {
+				return err
+			}
+			sessions = append(sessions, session)
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+func (s *BoltStore) put(bucket []byte, id string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(id), data)
+	})
+}
+
+func (s *BoltStore) SaveGame(game *Game) error {
+	return s.put(gamesBucket, game.ID, game)
+}
+
+func (s *BoltStore) SavePlayer(player *Player) error {
+	return s.put(playersBucket, player.ID, player)
+}
+
+func (s *BoltStore) SaveSession(session *Session) error {
+	return s.put(sessionsBucket, session.ID, session)
+}
+
+// LoadSecret returns the session secret, generating one on first use.
+func (s *BoltStore) LoadSecret() ([]byte, error) {
+	var secret []byte
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(metaBucket)
+		if stored := bucket.Get(secretKey); stored != nil {
+			secret = append([]byte{}, stored...)
+			return nil
+		}
+		generated, err := NewSecret()
+		if err != nil {
+			return err
+		}
+		secret = generated
+		return bucket.Put(secretKey, secret)
+	})
+	return secret, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.DB.Close()
+}
+
+// LoadStore replaces the in-memory games and players with the store's contents.
+func LoadStore(store Store) error {
+	games, err := store.LoadGames()
+	if err != nil {
+		return err
+	}
+	players, err := store.LoadPlayers()
+	if err != nil {
+		return err
+	}
+	sessions, err := store.LoadSessions()
+	if err != nil {
+		return err
+	}
+
+	Storage = store
+
+	gamesLock.Lock()
+	Games = map[string]*Game{}
+	for _, game := range games {
+		if len(game.Stages) == 0 {
+			game.Stages = LinearStages(4)
+		}
+		if game.Seats == 0 {
+			game.Seats = 1
+		}
+		for index := range game.Stages {
+			if game.Stages[index].ShippingDelay == 0 {
+				game.Stages[index].ShippingDelay = DEFAULT_SHIPPING_DELAY
+			}
+		}
+		for _, playerState := range game.PlayerState {
+			if playerState.LostSales == nil {
+				playerState.LostSales = make([]int, len(playerState.OutgoingPrev))
+			}
+			if playerState.CustomerBacklog == nil && game.ValidRole(playerState.Role) {
+				customer := MARKET
+				if customers := game.Customers(playerState.Role); len(customers) > 0 {
+					customer = customers[0]
+				}
+				playerState.CustomerBacklog = map[int]int{customer: playerState.Backlog}
+			}
+		}
+		if game.State == FINISHED && game.Debrief == nil {
+			game.Debrief = game.Analytics()
+		}
+		Games[game.ID] = game
+	}
+	gamesLock.Unlock()
+
+	playersLock.Lock()
+	Players = map[string]*Player{}
+	for _, player := range players {
+		Players[player.ID] = player
+	}
+	playersLock.Unlock()
+
+	sessionsLock.Lock()
+	Sessions = map[string]*Session{}
+	for _, session := range sessions {
+		Sessions[session.ID] = session
+	}
+	sessionsLock.Unlock()
+	return nil
+}
+
+func (game *Game) Save() {
+	if err := Storage.SaveGame(game); err != nil {
+		log.Printf("Failed to save game %s: %v", game.ID, err)
+	}
+}
+
+func (session *Session) Save() {
+	if err := Storage.SaveSession(session); err != nil {
+		log.Printf("Failed to save session %s: %v", session.ID, err)
+	}
+}
+
+func (player *Player) Save() {
+	if err := Storage.SavePlayer(player); err != nil {
+		log.Printf("Failed to save player %s: %v", player.ID, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateLegacyLocksOnlyOldOrders(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value string
+		ready bool
+	}{
+		{"saved before lockOrder", `{"state": 1, "playerState": [{"outgoing": 4}]}`, true},
+		{"pending order", `{"state": 1, "playerState": [{"outgoing": 4, "ready": false}]}`, false},
+		{"locked order", `{"state": 1, "playerState": [{"outgoing": 4, "ready": true}]}`, true},
+		{"no order", `{"state": 1, "playerState": [{"outgoing": -1}]}`, false},
+	} {
+		game := &Game{}
+		if err := json.Unmarshal([]byte(test.value), game); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrateLegacy(game, []byte(test.value)); err != nil {
+			t.Fatal(err)
+		}
+		if game.PlayerState[0].Ready != test.ready {
+			t.Errorf("%s: got ready %v, want %v", test.name, game.PlayerState[0].Ready, test.ready)
+		}
+	}
+}
+
+// TestBoltStoreReloadsGamesMidWeek saves a game partway through a week,
+// reopens the store and checks everything comes back as it was.
+func TestBoltStoreReloadsGamesMidWeek(t *testing.T) {
+	storage, games, savedPlayers, sessions := Storage, Games, Players, Sessions
+	defer func() {
+		Storage = storage
+		gamesLock.Lock()
+		Games = games
+		gamesLock.Unlock()
+		playersLock.Lock()
+		Players = savedPlayers
+		playersLock.Unlock()
+		sessionsLock.Lock()
+		Sessions = sessions
+		sessionsLock.Unlock()
+	}()
+	gamesLock.Lock()
+	Games = map[string]*Game{}
+	gamesLock.Unlock()
+	playersLock.Lock()
+	Players = map[string]*Player{}
+	playersLock.Unlock()
+	sessionsLock.Lock()
+	Sessions = map[string]*Session{}
+	sessionsLock.Unlock()
+
+	path := filepath.Join(t.TempDir(), "beergame.db")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Storage = store
+
+	players := []string{"stored-1", "stored-2", "stored-3", "stored-4"}
+	for _, playerID := range players {
+		CreatePlayer(playerID, "Player "+playerID)
+	}
+	session := CreateSession("stored-session", players[0])
+	game := newTestGame(t, "stored", players)
+	err = game.Apply(func() error {
+		if err := game.SetTurnLimit(600, DEFAULT_ORDER_INCOMING); err != nil {
+			return err
+		}
+		return game.Start()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playWeeks(t, game, []int{0, 4, 5, 6, 7}, 2)
+	game.Apply(func() error {
+		game.FindPlayerState(players[0]).Outgoing = 8
+		game.FindPlayerState(players[1]).Outgoing = 9
+		game.FindPlayerState(players[1]).Ready = true
+		return nil
+	})
+	defer func() {
+		game.lock.Lock()
+		game.timer.Stop()
+		game.lock.Unlock()
+	}()
+
+	saved := map[string][]byte{}
+	for name, value := range map[string]interface{}{"game": game, "player": FindPlayer(players[0]), "session": session} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved[name] = data
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := LoadStore(store); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]interface{}{"game": FindGame("stored"), "player": FindPlayer(players[0]), "session": FindSession("stored-session")} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(saved[name]) {
+			t.Errorf("the %s changed on reload:\n got %s\nwant %s", name, data, saved[name])
+		}
+	}
+	if week := FindGame("stored").Week; week != 2 {
+		t.Errorf("reloaded the game in week %d, want 2", week)
+	}
+}
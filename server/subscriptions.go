@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Two websocket subprotocols are supported. "graphql-ws" is the legacy
+// subscriptions-transport-ws protocol used by apollo-link-ws, while
+// "graphql-transport-ws" is the protocol of the newer graphql-ws library.
+// Clients that do not negotiate a subprotocol get the legacy one.
+const (
+	legacyProtocol    = "graphql-ws"
+	transportProtocol = "graphql-transport-ws"
+)
+
+const KeepAliveInterval = 10 * time.Second
+
+// ConnectionInitTimeout is how long a graphql-transport-ws client has to send
+// connection_init after opening the socket.
+var ConnectionInitTimeout = 10 * time.Second
+
+// Close codes of the graphql-transport-ws protocol. keepOpen means the
+// message was handled and the connection stays open.
+const (
+	keepOpen             = 0
+	closeNormal          = 1000
+	closeBadRequest      = 4400
+	closeUnauthorized    = 4401
+	closeInitTimeout     = 4408
+	closeSubscriberTaken = 4409
+	closeTooManyInits    = 4429
+)
+
+type Subscriber struct {
+	ID            int
+	Connection    *Connection
+	RequestString string
+	Variables     map[string]interface{}
+	OperationName string
+	OperationID   string
+	Topics        []string
+
+	pending chan struct{}
+	done    chan struct{}
+}
+
+// Connection is one websocket with the operations it has started. PlayerID
+// is taken from the handshake request or the connection_init payload.
+type Connection struct {
+	Conn       *websocket.Conn
+	Protocol   string
+	Acked      bool
+	PlayerID   string
+	Operations map[string]int
+
+	lock  sync.Mutex
+	write sync.Mutex
+}
+
+// SubscriptionHandler indexes subscribers by the topics their operation
+// depends on, so that a change only re-executes the affected operations.
+type SubscriptionHandler struct {
+	Schema      *graphql.Schema
+	NextID      int
+	Subscribers map[int]*Subscriber
+	Topics      map[string]map[int]*Subscriber
+
+	lock sync.Mutex
+}
+
+// Subscribers whose operation has no recognised topic argument are filed
+// under anyTopic and receive every publish.
+const anyTopic = ""
+
+func GameTopic(gameID string) string {
+	return "game/" + gameID
+}
+
+// topicArguments maps the arguments of top-level subscription fields to the
+// topic they select.
+var topicArguments = map[string]func(string) string{
+	"gameId":    GameTopic,
+	"sessionId": SessionTopic,
+}
+
+var Subscriptions SubscriptionHandler
+
+type SubscriptionMessage struct {
+	OperationID string          `json:"id,omitempty"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+type ConnectionInitPayload struct {
+	AuthToken string `json:"authToken"`
+}
+
+type SubscriptionPayload struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func (h *SubscriptionHandler) uniqueId() int {
+	id := h.NextID
+	h.NextID += 1
+	return id
+}
+
+func (h *SubscriptionHandler) handshake(config *websocket.Config, req *http.Request) error {
+	var err error
+	config.Origin, err = websocket.Origin(config, req)
+	if err == nil && config.Origin == nil {
+		return fmt.Errorf("null origin")
+	}
+	if err != nil {
+		return err
+	}
+
+	offered := config.Protocol
+	config.Protocol = nil
+	for _, protocol := range offered {
+		if protocol == transportProtocol || protocol == legacyProtocol {
+			config.Protocol = []string{protocol}
+			break
+		}
+	}
+	return nil
+}
+
+func (h *SubscriptionHandler) handler(ws *websocket.Conn) {
+	connection := &Connection{
+		Conn:       ws,
+		Protocol:   legacyProtocol,
+		PlayerID:   RequestPlayer(ws.Request()),
+		Operations: map[string]int{},
+	}
+	if protocols := ws.Config().Protocol; len(protocols) == 1 {
+		connection.Protocol = protocols[0]
+	}
+
+	code, reason := closeNormal, ""
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		h.closeConnection(connection)
+		connection.close(code, reason)
+	}()
+	go connection.keepAlive(done)
+
+	if connection.Protocol == transportProtocol {
+		ws.SetReadDeadline(time.Now().Add(ConnectionInitTimeout))
+	}
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if err, ok := err.(net.Error); ok && err.Timeout() && !connection.acked() {
+				code, reason = closeInitTimeout, "Connection initialisation timeout"
+			}
+			return
+		}
+
+		var msg SubscriptionMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			code, reason = closeBadRequest, "Invalid message received"
+			return
+		}
+		if code, reason = h.receive(connection, msg); code != keepOpen {
+			return
+		}
+	}
+}
+
+// receive handles one client message and returns keepOpen, or the code and
+// reason to close the connection with. The graphql-transport-ws protocol
+// requires the server to close the socket on protocol violations.
+func (h *SubscriptionHandler) receive(connection *Connection, msg SubscriptionMessage) (int, string) {
+	legacy := connection.Protocol == legacyProtocol
+
+	switch msg.Type {
+	case "connection_init":
+		var payload ConnectionInitPayload
+		json.Unmarshal(msg.Payload, &payload)
+		playerID, authenticated := VerifySessionToken(payload.AuthToken)
+
+		connection.lock.Lock()
+		duplicate := connection.Acked
+		connection.Acked = true
+		if authenticated {
+			connection.PlayerID = playerID
+		}
+		connection.lock.Unlock()
+		if duplicate && !legacy {
+			return closeTooManyInits, "Too many initialisation requests"
+		}
+		connection.Conn.SetReadDeadline(time.Time{})
+		connection.send(SubscriptionMessage{Type: "connection_ack"})
+		if legacy {
+			connection.send(SubscriptionMessage{Type: "ka"})
+		}
+	case "start", "subscribe":
+		if (msg.Type == "start") != legacy {
+			return h.unknownMessage(connection, msg)
+		}
+		if !connection.acked() {
+			if !legacy {
+				return closeUnauthorized, "Unauthorized"
+			}
+			connection.sendError(msg.OperationID, gqlerrors.NewFormattedError("Connection has not been initialised"))
+			return keepOpen, ""
+		}
+		return h.start(connection, msg)
+	case "stop", "complete":
+		if (msg.Type == "stop") != legacy {
+			return h.unknownMessage(connection, msg)
+		}
+		if h.stop(connection, msg.OperationID) && legacy {
+			connection.send(SubscriptionMessage{Type: "complete", OperationID: msg.OperationID})
+		}
+	case "connection_terminate":
+		return closeNormal, ""
+	case "ping":
+		if legacy {
+			return h.unknownMessage(connection, msg)
+		}
+		connection.send(SubscriptionMessage{Type: "pong", Payload: msg.Payload})
+	case "pong":
+		if legacy {
+			return h.unknownMessage(connection, msg)
+		}
+	default:
+		return h.unknownMessage(connection, msg)
+	}
+	return keepOpen, ""
+}
+
+func (h *SubscriptionHandler) unknownMessage(connection *Connection, msg SubscriptionMessage) (int, string) {
+	if connection.Protocol != legacyProtocol {
+		return closeBadRequest, "Unknown message type: " + msg.Type
+	}
+	connection.sendError(msg.OperationID, gqlerrors.NewFormattedError("Unknown message type: "+msg.Type))
+	return keepOpen, ""
+}
+
+func (h *SubscriptionHandler) start(connection *Connection, msg SubscriptionMessage) (int, string) {
+	var payload SubscriptionPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || (msg.OperationID == "" && connection.Protocol != legacyProtocol) {
+		if connection.Protocol != legacyProtocol {
+			return closeBadRequest, "Invalid subscribe message"
+		}
+		connection.sendError(msg.OperationID, gqlerrors.NewFormattedError("Invalid payload"))
+		return keepOpen, ""
+	}
+
+	operation, errs := h.validate(payload)
+	if len(errs) > 0 {
+		connection.sendError(msg.OperationID, errs...)
+		return keepOpen, ""
+	}
+
+	h.lock.Lock()
+	subscriber := &Subscriber{
+		ID:            h.uniqueId(),
+		Connection:    connection,
+		RequestString: payload.Query,
+		Variables:     payload.Variables,
+		OperationName: payload.OperationName,
+		OperationID:   msg.OperationID,
+		Topics:        subscriptionTopics(operation, payload.Variables),
+		pending:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	h.lock.Unlock()
+
+	connection.lock.Lock()
+	_, duplicate := connection.Operations[msg.OperationID]
+	if !duplicate {
+		connection.Operations[msg.OperationID] = subscriber.ID
+	}
+	connection.lock.Unlock()
+	if duplicate {
+		if connection.Protocol != legacyProtocol {
+			return closeSubscriberTaken, "Subscriber for " + msg.OperationID + " already exists"
+		}
+		connection.sendError(msg.OperationID, gqlerrors.NewFormattedError("Operation id is already in use"))
+		return keepOpen, ""
+	}
+
+	if operation.Operation != ast.OperationTypeSubscription {
+		// Queries and mutations sent over the socket produce a single result.
+		go func() {
+			subscriber.broadcast(h.Schema)
+			if h.stop(connection, subscriber.OperationID) {
+				connection.send(SubscriptionMessage{Type: "complete", OperationID: subscriber.OperationID})
+			}
+		}()
+		return keepOpen, ""
+	}
+
+	h.addSubscriber(subscriber)
+	go h.deliver(subscriber)
+	return keepOpen, ""
+}
+
+func subscriptionTopics(operation *ast.OperationDefinition, variables map[string]interface{}) []string {
+	topics := []string{}
+	if operation.SelectionSet == nil {
+		return topics
+	}
+	for _, selection := range operation.SelectionSet.Selections {
+		field, ok := selection.(*ast.Field)
+		if !ok {
+			continue
+		}
+		for _, argument := range field.Arguments {
+			topic, found := topicArguments[argument.Name.Value]
+			if !found {
+				continue
+			}
+			switch value := argument.Value.(type) {
+			case *ast.StringValue:
+				topics = append(topics, topic(value.Value))
+			case *ast.Variable:
+				if id, ok := variables[value.Name.Value].(string); ok {
+					topics = append(topics, topic(id))
+				}
+			}
+		}
+	}
+	return topics
+}
+
+// validate parses the request and returns the operation it will execute.
+func (h *SubscriptionHandler) validate(payload SubscriptionPayload) (*ast.OperationDefinition, []gqlerrors.FormattedError) {
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(payload.Query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+
+	result := graphql.ValidateDocument(h.Schema, document, nil)
+	if !result.IsValid {
+		return nil, result.Errors
+	}
+
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if payload.OperationName == "" || (operation.Name != nil && operation.Name.Value == payload.OperationName) {
+			return operation, nil
+		}
+	}
+	return nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError("Unknown operation")}
+}
+
+// stop forgets an operation, returning false if it was not running.
+func (h *SubscriptionHandler) stop(connection *Connection, operationID string) bool {
+	connection.lock.Lock()
+	id, found := connection.Operations[operationID]
+	delete(connection.Operations, operationID)
+	connection.lock.Unlock()
+
+	if found {
+		h.removeSubscriber(id)
+	}
+	return found
+}
+
+func (h *SubscriptionHandler) closeConnection(connection *Connection) {
+	connection.lock.Lock()
+	ids := []int{}
+	for _, id := range connection.Operations {
+		ids = append(ids, id)
+	}
+	connection.Operations = map[string]int{}
+	connection.lock.Unlock()
+
+	for _, id := range ids {
+		h.removeSubscriber(id)
+	}
+}
+
+func (h *SubscriptionHandler) addSubscriber(subscriber *Subscriber) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.Subscribers == nil {
+		h.Subscribers = map[int]*Subscriber{}
+		h.Topics = map[string]map[int]*Subscriber{}
+	}
+	h.Subscribers[subscriber.ID] = subscriber
+
+	topics := subscriber.Topics
+	if len(topics) == 0 {
+		topics = []string{anyTopic}
+	}
+	for _, topic := range topics {
+		if h.Topics[topic] == nil {
+			h.Topics[topic] = map[int]*Subscriber{}
+		}
+		h.Topics[topic][subscriber.ID] = subscriber
+	}
+}
+
+func (h *SubscriptionHandler) removeSubscriber(id int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	subscriber, found := h.Subscribers[id]
+	if !found {
+		return
+	}
+	delete(h.Subscribers, id)
+	close(subscriber.done)
+
+	topics := subscriber.Topics
+	if len(topics) == 0 {
+		topics = []string{anyTopic}
+	}
+	for _, topic := range topics {
+		delete(h.Topics[topic], id)
+		if len(h.Topics[topic]) == 0 {
+			delete(h.Topics, topic)
+		}
+	}
+}
+
+func (connection *Connection) acked() bool {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+	return connection.Acked
+}
+
+func (connection *Connection) context() context.Context {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+	return WithPlayer(context.Background(), connection.PlayerID)
+}
+
+func (connection *Connection) send(msg interface{}) bool {
+	connection.write.Lock()
+	defer connection.write.Unlock()
+	return websocket.JSON.Send(connection.Conn, msg) == nil
+}
+
+// close sends the close frame with code and reason. websocket.Conn.Close
+// always reports a normal closure, and the server closes the socket once the
+// handler returns.
+func (connection *Connection) close(code int, reason string) {
+	connection.write.Lock()
+	defer connection.write.Unlock()
+	writer, err := connection.Conn.NewFrameWriter(websocket.CloseFrame)
+	if err != nil {
+		return
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	writer.Write(append(payload, reason...))
+	writer.Close()
+}
+
+func (connection *Connection) sendError(operationID string, errs ...gqlerrors.FormattedError) {
+	var payload interface{} = errs
+	if connection.Protocol == legacyProtocol && len(errs) > 0 {
+		payload = errs[0]
+	}
+	connection.send(map[string]interface{}{
+		"type":    "error",
+		"id":      operationID,
+		"payload": payload,
+	})
+}
+
+func (connection *Connection) keepAlive(done chan struct{}) {
+	ticker := time.NewTicker(KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if connection.Protocol == legacyProtocol {
+				if connection.acked() {
+					connection.send(SubscriptionMessage{Type: "ka"})
+				}
+			} else {
+				connection.send(SubscriptionMessage{Type: "ping"})
+			}
+		}
+	}
+}
+
+func (subscriber *Subscriber) broadcast(schema *graphql.Schema) bool {
+	payload := graphql.Do(graphql.Params{
+		Schema:         *schema,
+		RequestString:  subscriber.RequestString,
+		VariableValues: subscriber.Variables,
+		OperationName:  subscriber.OperationName,
+		Context:        subscriber.Connection.context(),
+	})
+	msgType := "data"
+	if subscriber.Connection.Protocol != legacyProtocol {
+		msgType = "next"
+	}
+	msg := map[string]interface{}{
+		"type":    msgType,
+		"id":      subscriber.OperationID,
+		"payload": payload,
+	}
+	return subscriber.Connection.send(msg)
+}
+
+// deliver sends a subscriber its first result, then a new one after every
+// publish to its topics until it is removed. Each subscriber has its own
+// goroutine, so a client that is slow to read only holds up its own results.
+func (h *SubscriptionHandler) deliver(subscriber *Subscriber) {
+	for {
+		if !subscriber.broadcast(h.Schema) {
+			h.removeSubscriber(subscriber.ID)
+			return
+		}
+		select {
+		case <-subscriber.pending:
+		case <-subscriber.done:
+			return
+		}
+	}
+}
+
+// notify asks for the subscriber's operation to be re-executed without
+// waiting for it. Publishes made while a result is being sent are merged into
+// the next one, which reflects all of them.
+func (subscriber *Subscriber) notify() {
+	select {
+	case subscriber.pending <- struct{}{}:
+	default:
+	}
+}
+
+// publish re-executes the operations of every subscriber to topic. It is
+// called while handling mutations, so it only signals the subscribers.
+func (h *SubscriptionHandler) publish(topic string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, subscriber := range h.Topics[topic] {
+		subscriber.notify()
+	}
+	for _, subscriber := range h.Topics[anyTopic] {
+		subscriber.notify()
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// dialSubscriptions opens a graphql-transport-ws connection to a test server.
+func dialSubscriptions(t testing.TB, server *httptest.Server) *websocket.Conn {
+	config, err := websocket.NewConfig(strings.Replace(server.URL, "http", "ws", 1), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Protocol = []string{transportProtocol}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+func subscriptionServer(t testing.TB) *httptest.Server {
+	testSchema(t)
+	return httptest.NewServer(websocket.Server{
+		Handshake: Subscriptions.handshake,
+		Handler:   Subscriptions.handler,
+	})
+}
+
+// subscribe starts operations on ws and waits for the first result of each.
+func subscribe(t testing.TB, ws *websocket.Conn, queries ...string) {
+	websocket.JSON.Send(ws, SubscriptionMessage{Type: "connection_init"})
+	var msg SubscriptionMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "connection_ack" {
+		t.Fatalf("got %+v (%v), want connection_ack", msg, err)
+	}
+	for index, query := range queries {
+		payload := fmt.Sprintf(`{"query": %q}`, query)
+		websocket.JSON.Send(ws, SubscriptionMessage{
+			OperationID: fmt.Sprint(index),
+			Type:        "subscribe",
+			Payload:     []byte(payload),
+		})
+	}
+	for range queries {
+		if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "next" {
+			t.Fatalf("got %+v (%v), want next", msg, err)
+		}
+	}
+}
+
+// closeCode skips messages until the server closes ws and returns its code.
+func closeCode(t testing.TB, ws *websocket.Conn) int {
+	for {
+		frame, err := ws.NewFrameReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.PayloadType() == websocket.CloseFrame && len(data) >= 2 {
+			return int(binary.BigEndian.Uint16(data))
+		}
+	}
+}
+
+func TestTransportCloseCodes(t *testing.T) {
+	server := subscriptionServer(t)
+	defer server.Close()
+	FindOrCreateGame("closing", "")
+
+	init := `{"type": "connection_init"}`
+	subscribe := `{"id": "1", "type": "subscribe", "payload": {"query": "subscription { game(gameId: \"closing\") { week } }"}}`
+	tests := []struct {
+		name     string
+		messages []string
+		code     int
+	}{
+		{"invalid json", []string{init, `{"type": `}, closeBadRequest},
+		{"unknown type", []string{init, `{"type": "start"}`}, closeBadRequest},
+		{"subscribe without id", []string{init, `{"type": "subscribe", "payload": {"query": "{ games { id } }"}}`}, closeBadRequest},
+		{"subscribe before init", []string{subscribe}, closeUnauthorized},
+		{"duplicate subscriber", []string{init, subscribe, subscribe}, closeSubscriberTaken},
+		{"duplicate init", []string{init, init}, closeTooManyInits},
+		{"terminate", []string{init, `{"type": "connection_terminate"}`}, closeNormal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ws := dialSubscriptions(t, server)
+			defer ws.Close()
+			for _, message := range test.messages {
+				websocket.Message.Send(ws, message)
+			}
+			if code := closeCode(t, ws); code != test.code {
+				t.Errorf("closed with %d, want %d", code, test.code)
+			}
+		})
+	}
+}
+
+func TestConnectionInitTimeout(t *testing.T) {
+	timeout := ConnectionInitTimeout
+	ConnectionInitTimeout = 100 * time.Millisecond
+	defer func() { ConnectionInitTimeout = timeout }()
+	server := subscriptionServer(t)
+	defer server.Close()
+	ws := dialSubscriptions(t, server)
+	defer ws.Close()
+
+	start := time.Now()
+	if code := closeCode(t, ws); code != closeInitTimeout {
+		t.Errorf("closed with %d, want %d", code, closeInitTimeout)
+	}
+	if waited := time.Since(start); waited < ConnectionInitTimeout/2 {
+		t.Errorf("closed after %s, before the client had time to initialise", waited)
+	}
+}
+
+// TestPublishDoesNotWaitForSubscribers publishes while the subscriber's
+// operation cannot run, as it would be while a mutation holds the game lock.
+func TestPublishDoesNotWaitForSubscribers(t *testing.T) {
+	server := subscriptionServer(t)
+	defer server.Close()
+	game := FindOrCreateGame("slow", "")
+	ws := dialSubscriptions(t, server)
+	defer ws.Close()
+	subscribe(t, ws, `subscription { game(gameId: "slow") { week } }`)
+
+	game.lock.Lock()
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			Subscriptions.publish(GameTopic("slow"))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Error("publishing waited for a subscriber's operation")
+	}
+	game.lock.Unlock()
+
+	var msg SubscriptionMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "next" {
+		t.Errorf("got %+v (%v), want next", msg, err)
+	}
+}
+
+// BenchmarkPublish measures a change to one of games games, each followed by
+// subscribers subscribers, from the mutation's publish until every subscriber
+// of that game has received its re-executed result. ns/delivery should stay
+// flat as games grows: only the changed game's subscribers do any work.
+func BenchmarkPublish(b *testing.B) {
+	for _, games := range []int{1, 10, 100} {
+		for _, subscribers := range []int{1, 10, 50} {
+			b.Run(fmt.Sprintf("games=%d/subscribers=%d", games, subscribers), func(b *testing.B) {
+				benchmarkPublish(b, games, subscribers)
+			})
+		}
+	}
+}
+
+const benchmarkQuery = `subscription { game(gameId: %q) { week status playerState { player { name } stage ready } } }`
+
+func benchmarkPublish(b *testing.B, games int, subscribers int) {
+	server := subscriptionServer(b)
+	defer server.Close()
+
+	benchGames := make([]*Game, games)
+	received := make([]chan struct{}, games)
+	for index := range benchGames {
+		id := fmt.Sprintf("bench-%d", index)
+		benchGames[index] = newTestGame(b, id, []string{id + "-1", id + "-2", id + "-3", id + "-4"})
+		received[index] = make(chan struct{}, subscribers)
+
+		queries := make([]string, subscribers)
+		for query := range queries {
+			queries[query] = fmt.Sprintf(benchmarkQuery, id)
+		}
+		ws := dialSubscriptions(b, server)
+		defer ws.Close()
+		subscribe(b, ws, queries...)
+		go func(received chan struct{}) {
+			var msg SubscriptionMessage
+			for websocket.JSON.Receive(ws, &msg) == nil {
+				if msg.Type == "next" {
+					received <- struct{}{}
+				}
+			}
+		}(received[index])
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index := i % games
+		benchGames[index].Update(func() bool { return true })
+		for subscriber := 0; subscriber < subscribers; subscriber++ {
+			<-received[index]
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*subscribers), "ns/delivery")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"time"
+)
+
+// A game with a turn limit gives players that long to order each week. When
+// time runs out the laggards are given their default order and the week
+// advances. Pausing cancels the deadline; the turn starts over on resume.
+
+const MAX_TURN_LIMIT = 3600
+
+const (
+	DEFAULT_ORDER_REPEAT = iota
+	DEFAULT_ORDER_INCOMING
+	DEFAULT_ORDER_ZERO
+)
+
+var DefaultOrderMappings = []NameValueMapping{
+	NameValueMapping{
+		Name:  "repeat last order",
+		Value: DEFAULT_ORDER_REPEAT,
+	},
+	NameValueMapping{
+		Name:  "order incoming",
+		Value: DEFAULT_ORDER_INCOMING,
+	},
+	NameValueMapping{
+		Name:  "zero",
+		Value: DEFAULT_ORDER_ZERO,
+	},
+}
+
+// DefaultOrder is what playerState orders if they run out of time.
+func (game *Game) DefaultOrder(playerState *PlayerState) int {
+	switch game.DefaultOrderPolicy {
+	case DEFAULT_ORDER_REPEAT:
+		if count := len(playerState.OutgoingPrev); count > 0 {
+			return playerState.OutgoingPrev[count-1]
+		}
+	case DEFAULT_ORDER_INCOMING:
+		return playerState.Incoming
+	}
+	return 0
+}
+
+func (game *Game) SetTurnLimit(seconds int, policy int) error {
+	if game.State == FINISHED {
+		return NewGameError(ERROR_GAME_FINISHED, "the game is over")
+	}
+	if seconds < 0 || seconds > MAX_TURN_LIMIT {
+		return errInvalidArgument("turn limits must be 0 to %d seconds", MAX_TURN_LIMIT)
+	}
+	if policy < 0 || policy >= len(DefaultOrderMappings) {
+		return errInvalidArgument("there is no default order policy %d", policy)
+	}
+	game.TurnLimit = seconds
+	game.DefaultOrderPolicy = policy
+	game.scheduleTurn()
+	return nil
+}
+
+// RemainingTime is how long players have left to order this week.
+func (game *Game) RemainingTime() time.Duration {
+	if game.Deadline.IsZero() {
+		return 0
+	}
+	if remaining := time.Until(game.Deadline); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// StartTimers arms the turn timers of games loaded from the store.
+func StartTimers() {
+	gamesLock.Lock()
+	defer gamesLock.Unlock()
+	for _, game := range Games {
+		game.lock.Lock()
+		game.startTimer()
+		game.lock.Unlock()
+	}
+}
+
+// scheduleTurn starts the clock on the current week. It must be called with
+// the game locked whenever a week opens or the game stops.
+func (game *Game) scheduleTurn() {
+	game.Deadline = time.Time{}
+	if game.State == PLAYING && game.TurnLimit > 0 {
+		game.Deadline = time.Now().Add(time.Duration(game.TurnLimit) * time.Second)
+	}
+	game.startTimer()
+}
+
+// startTimer arms the timer for the current deadline, if any. Stopping the
+// old timer does not stop a callback that has already fired and is waiting
+// for the lock, so each callback checks it still belongs to the latest timer.
+func (game *Game) startTimer() {
+	game.timerGen++
+	if game.timer != nil {
+		game.timer.Stop()
+		game.timer = nil
+	}
+	if game.Deadline.IsZero() {
+		return
+	}
+
+	generation := game.timerGen
+	game.timer = time.AfterFunc(time.Until(game.Deadline), func() {
+		game.Update(func() bool {
+			if game.timerGen != generation || game.State != PLAYING {
+				return false
+			}
+			return game.ForceStep() == nil
+		})
+	})
+}
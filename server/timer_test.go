@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRearmedTimerIgnoresStaleCallback re-arms the turn timer while the old
+// one has fired and is waiting for the lock.
+func TestRearmedTimerIgnoresStaleCallback(t *testing.T) {
+	players := []string{"timer-1", "timer-2", "timer-3", "timer-4"}
+	game := newTestGame(t, "timer", players)
+	if err := game.Apply(game.Start); err != nil {
+		t.Fatal(err)
+	}
+
+	game.lock.Lock()
+	game.Deadline = time.Now().Add(time.Millisecond)
+	game.startTimer()
+	time.Sleep(20 * time.Millisecond)
+	game.Deadline = time.Now().Add(time.Hour)
+	game.startTimer()
+	game.lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	game.lock.Lock()
+	week := game.Week
+	game.timer.Stop()
+	game.lock.Unlock()
+	if week != 0 {
+		t.Errorf("the stale timer advanced the game to week %d", week)
+	}
+}